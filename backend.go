@@ -0,0 +1,195 @@
+package traefik_forward_filter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Backend executes a built forward request against the auth endpoint and
+// returns its decision as an *http.Response, the shape ServeHTTP already
+// knows how to interpret (status code + headers, and a body for non-2xx
+// responses that carry one).
+type Backend interface {
+	Do(forwardReq *http.Request) (*http.Response, error)
+}
+
+// newBackend selects a Backend implementation from the scheme of
+// config.Address: "unix" for a Unix domain socket, "grpc"/"grpcs" for an
+// Envoy-style ext_authz sidecar, "http"/"https" for plain HTTP(S). Any other
+// scheme is rejected with an error.
+func newBackend(u *url.URL, config *Config, timeout time.Duration) (Backend, *url.URL, error) {
+	switch u.Scheme {
+	case "unix":
+		return newUnixBackend(u.Path, config, timeout)
+	case "grpc", "grpcs":
+		return newGRPCBackend(u, config, timeout)
+	case "http", "https":
+		backend, err := newHTTPBackend(config, timeout, u.Scheme == "https")
+		if err != nil {
+			return nil, nil, err
+		}
+		return backend, u, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported address scheme %q", u.Scheme)
+	}
+}
+
+type httpBackend struct {
+	client *http.Client
+}
+
+// buildTransport clones http.DefaultTransport and applies the pool sizing
+// and TLS options from config. It's always cloned, not just when
+// InsecureSkipVerify is set, so MaxIdleConnsPerHost et al. actually apply.
+// HTTP/2 is handled separately by newForwardRoundTripper, since forcing it
+// over a Unix socket or a plaintext Address needs a dedicated RoundTripper
+// rather than ALPN negotiation on this transport.
+func buildTransport(config *Config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig, err := buildTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if config.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+	if config.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = config.MaxConnsPerHost
+	}
+	if config.IdleConnTimeoutMs > 0 {
+		transport.IdleConnTimeout = time.Duration(config.IdleConnTimeoutMs) * time.Millisecond
+	}
+	transport.DisableKeepAlives = config.DisableKeepAlives
+
+	if config.DialTimeoutMs > 0 {
+		dialer := &net.Dialer{Timeout: time.Duration(config.DialTimeoutMs) * time.Millisecond}
+		transport.DialContext = dialer.DialContext
+	}
+
+	return transport, nil
+}
+
+func buildTLSConfig(config *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+
+	if config.ClientCertFile != "" || config.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.ClientCertFile, config.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if config.RootCAFile != "" {
+		pem, err := os.ReadFile(config.RootCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading root CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.RootCAFile)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+func newHTTPBackend(config *Config, timeout time.Duration, useTLS bool) (*httpBackend, error) {
+	transport, err := buildTransport(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout:   timeout,
+		Transport: newForwardRoundTripper(transport, config.ForceHTTP2, useTLS),
+	}
+
+	return &httpBackend{client: client}, nil
+}
+
+// newForwardRoundTripper swaps in an h2c-capable *http2.Transport when
+// forceHTTP2 is set, so a plaintext (http://) auth Address can still be
+// multiplexed over a single HTTP/2 connection. useTLS tells DialTLSContext
+// whether to actually negotiate TLS on the dialed connection: http2.Transport
+// always hands it a non-nil *tls.Config (it builds one itself even when
+// TLSClientConfig is nil), so that parameter can't be used to tell a
+// plaintext h2c dial apart from a real TLS one.
+func newForwardRoundTripper(transport *http.Transport, forceHTTP2, useTLS bool) http.RoundTripper {
+	if !forceHTTP2 {
+		return transport
+	}
+
+	return &http2.Transport{
+		AllowHTTP:       true,
+		TLSClientConfig: transport.TLSClientConfig,
+		DialTLSContext: func(ctx context.Context, network, addr string, tlsConfig *tls.Config) (net.Conn, error) {
+			conn, err := transport.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			if !useTLS {
+				return conn, nil
+			}
+			return tls.Client(conn, tlsConfig), nil
+		},
+	}
+}
+
+func (b *httpBackend) Do(forwardReq *http.Request) (*http.Response, error) {
+	return b.client.Do(forwardReq)
+}
+
+// unixBackend dials a Unix domain socket instead of resolving the request
+// URL's host. The forward request's URL keeps whatever path ServeHTTP
+// assigned it (the auth path, or the incoming request's URI); only the
+// dial target changes.
+type unixBackend struct {
+	*httpBackend
+}
+
+// unixDialer builds the net.Dialer used to reach socketPath, applying
+// config.DialTimeoutMs the same way buildTransport does for TCP backends.
+func unixDialer(config *Config) net.Dialer {
+	return net.Dialer{Timeout: time.Duration(config.DialTimeoutMs) * time.Millisecond}
+}
+
+func newUnixBackend(socketPath string, config *Config, timeout time.Duration) (*unixBackend, *url.URL, error) {
+	transport, err := buildTransport(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	d := unixDialer(config)
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return d.DialContext(ctx, "unix", socketPath)
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+		Timeout:   timeout,
+		Transport: newForwardRoundTripper(transport, config.ForceHTTP2, false),
+	}
+
+	return &unixBackend{httpBackend: &httpBackend{client: client}}, &url.URL{Scheme: "http", Host: "unix"}, nil
+}
@@ -0,0 +1,212 @@
+package traefik_forward_filter
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// newH2CTestServer starts a plaintext HTTP/2 (h2c) server, so tests can
+// confirm a RoundTripper reaches it without attempting a TLS handshake over
+// the plaintext connection.
+func newH2CTestServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(h2c.NewHandler(handler, &http2.Server{}))
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newUnixListener(t *testing.T) net.Listener {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "auth.sock")
+
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("net.Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	return ln
+}
+
+func TestNewBackendSelectsImplementationByScheme(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawURL  string
+		wantErr bool
+	}{
+		{name: "http", rawURL: "http://example.com"},
+		{name: "https", rawURL: "https://example.com"},
+		{name: "unix", rawURL: "unix:///var/run/auth.sock"},
+		{name: "grpc", rawURL: "grpc://example.com:9000"},
+		{name: "grpcs", rawURL: "grpcs://example.com:9000"},
+		{name: "unsupported scheme", rawURL: "ftp://example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.rawURL)
+			if err != nil {
+				t.Fatalf("url.Parse: %v", err)
+			}
+
+			backend, _, err := newBackend(u, &Config{}, time.Second)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error for an unsupported scheme")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("newBackend: %v", err)
+			}
+			if backend == nil {
+				t.Fatal("expected a non-nil backend")
+			}
+		})
+	}
+}
+
+func TestNewBackendUnixRewritesURLToHTTP(t *testing.T) {
+	u, err := url.Parse("unix:///var/run/auth.sock")
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+
+	_, rewritten, err := newBackend(u, &Config{}, time.Second)
+	if err != nil {
+		t.Fatalf("newBackend: %v", err)
+	}
+
+	if rewritten.Scheme != "http" {
+		t.Errorf("rewritten scheme = %q, want %q", rewritten.Scheme, "http")
+	}
+}
+
+func TestBuildTLSConfigInsecureSkipVerify(t *testing.T) {
+	tlsConfig, err := buildTLSConfig(&Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("buildTLSConfig: %v", err)
+	}
+
+	if !tlsConfig.InsecureSkipVerify {
+		t.Error("expected InsecureSkipVerify to be carried through")
+	}
+}
+
+func TestBuildTLSConfigRejectsUnreadableRootCA(t *testing.T) {
+	_, err := buildTLSConfig(&Config{RootCAFile: "/nonexistent/root-ca.pem"})
+	if err == nil {
+		t.Fatal("expected an error for a missing RootCAFile")
+	}
+}
+
+func TestBuildTLSConfigRejectsBadClientCert(t *testing.T) {
+	_, err := buildTLSConfig(&Config{ClientCertFile: "/nonexistent/cert.pem", ClientKeyFile: "/nonexistent/key.pem"})
+	if err == nil {
+		t.Fatal("expected an error for a missing client certificate")
+	}
+}
+
+func TestNewForwardRoundTripperReturnsTransportUnchangedByDefault(t *testing.T) {
+	transport := &http.Transport{}
+
+	rt := newForwardRoundTripper(transport, false, false)
+
+	if rt != transport {
+		t.Fatal("expected newForwardRoundTripper to return transport as-is when forceHTTP2 is false")
+	}
+}
+
+func TestNewForwardRoundTripperWrapsInHTTP2TransportWhenForced(t *testing.T) {
+	transport := &http.Transport{}
+
+	rt := newForwardRoundTripper(transport, true, false)
+
+	h2, ok := rt.(*http2.Transport)
+	if !ok {
+		t.Fatalf("expected a *http2.Transport, got %T", rt)
+	}
+	if !h2.AllowHTTP {
+		t.Error("expected AllowHTTP to allow h2c over a plaintext Address")
+	}
+}
+
+func TestNewForwardRoundTripperDialsPlaintextH2CWithoutTLS(t *testing.T) {
+	server := newH2CTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rt := newForwardRoundTripper(&http.Transport{DialContext: (&net.Dialer{}).DialContext}, true, false)
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+server.Listener.Addr().String()+"/", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest: %v", err)
+	}
+
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestUnixBackendDialsSocket(t *testing.T) {
+	ln := newUnixListener(t)
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})}
+	go server.Serve(ln)
+	defer server.Close()
+
+	backend, rewritten, err := newUnixBackend(ln.Addr().String(), &Config{}, time.Second)
+	if err != nil {
+		t.Fatalf("newUnixBackend: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, rewritten.String()+"/", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest: %v", err)
+	}
+
+	resp, err := backend.Do(req)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestUnixDialerAppliesConfiguredTimeout(t *testing.T) {
+	d := unixDialer(&Config{DialTimeoutMs: 500})
+	if d.Timeout != 500*time.Millisecond {
+		t.Errorf("Timeout = %v, want %v", d.Timeout, 500*time.Millisecond)
+	}
+}
+
+func TestUnixDialerDefaultsToNoTimeout(t *testing.T) {
+	d := unixDialer(&Config{})
+	if d.Timeout != 0 {
+		t.Errorf("Timeout = %v, want 0 (no timeout) when DialTimeoutMs is unset", d.Timeout)
+	}
+}
@@ -0,0 +1,129 @@
+package traefik_forward_filter
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+const (
+	// RequestBodyOverflowTruncate forwards only the first MaxRequestBodyBytes
+	// of the request body to Address, while still passing the full body
+	// downstream.
+	RequestBodyOverflowTruncate = "truncate"
+	// RequestBodyOverflowAbort applies FailurePolicy, without calling
+	// Address at all, once the body exceeds MaxRequestBodyBytes.
+	RequestBodyOverflowAbort = "abort"
+)
+
+// DefaultRequestBodySpillThreshold is the amount of request body buffered in
+// memory before bodySpool overflows to a temp file.
+const DefaultRequestBodySpillThreshold = 1 << 20 // 1 MiB
+
+// bodySpool buffers a request body up to a threshold in memory, then spills
+// the remainder to a temp file, so that RequestWithBody never holds an
+// arbitrarily large request in an unbounded buffer. It is read back through
+// Reader: once for each attempt to forward the body to Address, and once for
+// the replay body handed to next.
+type bodySpool struct {
+	threshold int64
+	mem       *bytes.Buffer
+	file      *os.File
+	size      int64
+}
+
+func newBodySpool(threshold int64) *bodySpool {
+	if threshold <= 0 {
+		threshold = DefaultRequestBodySpillThreshold
+	}
+
+	return &bodySpool{threshold: threshold, mem: new(bytes.Buffer)}
+}
+
+func (s *bodySpool) Write(p []byte) (int, error) {
+	if s.file != nil {
+		n, err := s.file.Write(p)
+		s.size += int64(n)
+		return n, err
+	}
+
+	if int64(s.mem.Len())+int64(len(p)) > s.threshold {
+		file, err := os.CreateTemp("", "traefik-forward-filter-body-*")
+		if err != nil {
+			return 0, err
+		}
+
+		if _, err := file.Write(s.mem.Bytes()); err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return 0, err
+		}
+
+		s.mem = nil
+		s.file = file
+
+		n, err := s.file.Write(p)
+		s.size += int64(n)
+		return n, err
+	}
+
+	n, err := s.mem.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+// Size reports the number of bytes written so far.
+func (s *bodySpool) Size() int64 {
+	return s.size
+}
+
+// Reader returns a fresh, independent ReadCloser over everything written so
+// far. Callers may hold more than one Reader concurrently: once the spool
+// has overflowed to disk, each Reader opens its own file handle rather than
+// sharing the write handle's cursor. The caller is responsible for closing
+// it.
+func (s *bodySpool) Reader() (io.ReadCloser, error) {
+	if s.file != nil {
+		return os.Open(s.file.Name())
+	}
+
+	return io.NopCloser(bytes.NewReader(s.mem.Bytes())), nil
+}
+
+// limitReadCloser pairs a size-limited reader with the underlying spool
+// reader's Close, so capping the forward body at MaxRequestBodyBytes
+// doesn't leak the file handle behind it.
+type limitReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// multiReadCloser concatenates readers like io.MultiReader, but also closes
+// every underlying Closer, so stitching the already-spooled prefix of a body
+// back onto its unread remainder doesn't leak either one.
+type multiReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (m multiReadCloser) Close() error {
+	var err error
+	for _, c := range m.closers {
+		if e := c.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Close releases the spill file, if any. Safe to call on a spool that never
+// overflowed to disk.
+func (s *bodySpool) Close() error {
+	if s.file == nil {
+		return nil
+	}
+
+	name := s.file.Name()
+	s.file.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,152 @@
+package traefik_forward_filter
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func TestBodySpoolStaysInMemoryUnderThreshold(t *testing.T) {
+	s := newBodySpool(1024)
+
+	if _, err := s.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if s.file != nil {
+		t.Fatal("expected spool to stay in memory under threshold")
+	}
+	if got := s.Size(); got != 5 {
+		t.Errorf("Size() = %d, want 5", got)
+	}
+
+	r, err := s.Reader()
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("data = %q, want %q", data, "hello")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
+
+func TestBodySpoolSpillsToDiskOverThreshold(t *testing.T) {
+	s := newBodySpool(4)
+	defer s.Close()
+
+	if _, err := s.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if s.file == nil {
+		t.Fatal("expected spool to spill to disk once threshold is exceeded")
+	}
+	if got := s.Size(); got != 5 {
+		t.Errorf("Size() = %d, want 5", got)
+	}
+
+	r, err := s.Reader()
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Errorf("data = %q, want %q", data, "hello")
+	}
+}
+
+func TestBodySpoolReaderIsIndependentAfterSpill(t *testing.T) {
+	s := newBodySpool(4)
+	defer s.Close()
+
+	if _, err := s.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	first, err := s.Reader()
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+
+	second, err := s.Reader()
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+
+	firstData, _ := io.ReadAll(first)
+	first.Close()
+
+	secondData, _ := io.ReadAll(second)
+	second.Close()
+
+	if string(firstData) != "hello" || string(secondData) != "hello" {
+		t.Fatalf("got firstData=%q secondData=%q, want both %q", firstData, secondData, "hello")
+	}
+}
+
+func TestBodySpoolCloseRemovesSpillFile(t *testing.T) {
+	s := newBodySpool(4)
+
+	if _, err := s.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	name := s.file.Name()
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if _, err := os.Stat(name); err == nil {
+		t.Fatal("expected spill file to be removed after Close")
+	}
+}
+
+func TestLimitReadCloserClosesUnderlyingCloser(t *testing.T) {
+	s := newBodySpool(4)
+
+	if _, err := s.Write([]byte("hello world")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	r, err := s.Reader()
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+
+	lrc := &limitReadCloser{Reader: io.LimitReader(r, 4), Closer: r}
+
+	data, err := io.ReadAll(lrc)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(data) != "hell" {
+		t.Errorf("data = %q, want %q", data, "hell")
+	}
+
+	if err := lrc.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	if _, err := r.Read(make([]byte, 1)); err == nil {
+		t.Error("expected limitReadCloser.Close to close the underlying reader")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
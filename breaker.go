@@ -0,0 +1,121 @@
+package traefik_forward_filter
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// BreakerState is reported to Config.BreakerMetrics on every state
+// transition of the circuit breaker guarding the auth backend.
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker trips after ConsecutiveFailures back-to-back failures,
+// short-circuiting the auth call with FailurePolicy for OpenDuration before
+// letting a bounded number of half-open probes through to test recovery.
+type circuitBreaker struct {
+	mu sync.Mutex
+
+	threshold    int
+	openDuration time.Duration
+	halfOpenMax  int
+	onEvent      func(BreakerState)
+
+	state            BreakerState
+	consecutiveFails int
+	openUntil        time.Time
+	halfOpenInFlight int
+}
+
+func newCircuitBreaker(config *Config) *circuitBreaker {
+	halfOpenMax := config.HalfOpenProbes
+	if halfOpenMax <= 0 {
+		halfOpenMax = 1
+	}
+
+	return &circuitBreaker{
+		threshold:    config.ConsecutiveFailures,
+		openDuration: time.Duration(config.OpenDurationMs) * time.Millisecond,
+		halfOpenMax:  halfOpenMax,
+		onEvent:      config.BreakerMetrics,
+	}
+}
+
+// allow reports whether a call should be attempted, reserving a half-open
+// probe slot if it transitions the breaker out of open.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Now().Before(b.openUntil) {
+			return false
+		}
+		b.transition(BreakerHalfOpen)
+		b.halfOpenInFlight = 0
+		fallthrough
+	case BreakerHalfOpen:
+		if b.halfOpenInFlight >= b.halfOpenMax {
+			return false
+		}
+		b.halfOpenInFlight++
+		return true
+	default:
+		return true
+	}
+}
+
+// record updates the breaker with the outcome of a call permitted by allow.
+func (b *circuitBreaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		b.consecutiveFails = 0
+
+		if b.state != BreakerClosed {
+			b.transition(BreakerClosed)
+		}
+
+		return
+	}
+
+	b.consecutiveFails++
+
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.consecutiveFails >= b.threshold) {
+		b.openUntil = time.Now().Add(b.openDuration)
+		b.transition(BreakerOpen)
+	}
+}
+
+// transition must be called with mu held.
+func (b *circuitBreaker) transition(to BreakerState) {
+	if b.state == to {
+		return
+	}
+
+	log.Printf("forward auth circuit breaker: %s -> %s", b.state, to)
+	b.state = to
+
+	if b.onEvent != nil {
+		b.onEvent(to)
+	}
+}
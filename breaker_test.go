@@ -0,0 +1,51 @@
+package traefik_forward_filter
+
+import "testing"
+
+func TestCircuitBreakerTripsAndRecovers(t *testing.T) {
+	b := newCircuitBreaker(&Config{ConsecutiveFailures: 2, OpenDurationMs: 0, HalfOpenProbes: 1})
+
+	if !b.allow() {
+		t.Fatal("expected breaker to start closed")
+	}
+	b.record(false)
+
+	if !b.allow() {
+		t.Fatal("expected breaker to still allow before threshold is reached")
+	}
+	b.record(false)
+
+	if b.state != BreakerOpen {
+		t.Fatalf("state = %s, want %s", b.state, BreakerOpen)
+	}
+
+	// OpenDurationMs is 0, so the breaker should immediately let a
+	// half-open probe through.
+	if !b.allow() {
+		t.Fatal("expected a half-open probe to be allowed")
+	}
+	b.record(true)
+
+	if b.state != BreakerClosed {
+		t.Fatalf("state = %s, want %s after a successful probe", b.state, BreakerClosed)
+	}
+}
+
+func TestCircuitBreakerDefaultsHalfOpenProbes(t *testing.T) {
+	b := newCircuitBreaker(&Config{ConsecutiveFailures: 1, OpenDurationMs: 0})
+
+	if !b.allow() {
+		t.Fatal("expected breaker to start closed")
+	}
+	b.record(false)
+
+	if b.state != BreakerOpen {
+		t.Fatalf("state = %s, want %s", b.state, BreakerOpen)
+	}
+
+	// HalfOpenProbes was left unset (zero value); the breaker must still
+	// let at least one probe through, or it can never close again.
+	if !b.allow() {
+		t.Fatal("expected a half-open probe to be allowed when HalfOpenProbes is unset")
+	}
+}
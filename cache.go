@@ -0,0 +1,261 @@
+package traefik_forward_filter
+
+import (
+	"container/list"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is used for cacheable 2xx decisions when the auth
+// response carries no Cache-Control: max-age and CacheMinTTL/CacheMaxTTL
+// don't otherwise constrain it.
+const DefaultCacheTTL = time.Second * 10
+
+// DefaultCacheMaxEntries bounds the cache size when CacheMaxEntries is left
+// unset.
+const DefaultCacheMaxEntries = 10000
+
+// CacheEvent is reported to Config.CacheMetrics, when set, on every lookup
+// against the auth decision cache.
+type CacheEvent int
+
+const (
+	CacheHit CacheEvent = iota
+	CacheMiss
+)
+
+type cacheEntry struct {
+	statusCode int
+	// header is the full raw response header set, not just the
+	// ResponseHeaders allowlist, so responseHeaderRules replayed from the
+	// cache can still read whatever header they key off.
+	header http.Header
+	// body is the response body, when Address sent one (e.g. a JSON
+	// denial payload, or a 2xx meant to be written back to the client
+	// directly rather than passed to next). Empty for a bodyless decision.
+	body      []byte
+	expiresAt time.Time
+}
+
+// authCache is an in-process LRU+TTL cache of auth decisions, keyed by a
+// configurable subset of the incoming request's headers. It exists so that
+// repeated requests carrying the same credentials don't each round-trip to
+// the auth Address.
+type authCache struct {
+	mu          sync.Mutex
+	ll          *list.List
+	items       map[string]*list.Element
+	maxEntries  int
+	minTTL      time.Duration
+	maxTTL      time.Duration
+	negativeTTL time.Duration
+	keyHeaders  []string
+	includeIP   bool
+	onEvent     func(CacheEvent)
+}
+
+type cacheListEntry struct {
+	key   string
+	entry cacheEntry
+}
+
+func newAuthCache(config *Config) *authCache {
+	maxEntries := config.CacheMaxEntries
+	if maxEntries <= 0 {
+		maxEntries = DefaultCacheMaxEntries
+	}
+
+	minTTL := time.Duration(config.CacheMinTTL) * time.Millisecond
+	maxTTL := time.Duration(config.CacheMaxTTL) * time.Millisecond
+	if maxTTL <= 0 {
+		maxTTL = DefaultCacheTTL
+	}
+	if minTTL > maxTTL {
+		minTTL = maxTTL
+	}
+
+	return &authCache{
+		ll:          list.New(),
+		items:       make(map[string]*list.Element),
+		maxEntries:  maxEntries,
+		minTTL:      minTTL,
+		maxTTL:      maxTTL,
+		negativeTTL: time.Duration(config.CacheNegativeTTL) * time.Millisecond,
+		keyHeaders:  config.CacheKeyHeaders,
+		includeIP:   config.CacheIncludeClientIP,
+		onEvent:     config.CacheMetrics,
+	}
+}
+
+// key builds the cache key from the request method and path plus the
+// configured subset of request headers (and the source IP, when enabled).
+// An empty CacheKeyHeaders falls back to Authorization alone, the common
+// case for forward-auth. The method and path are always included, since a
+// single ForwardFilter is commonly attached to a router covering many
+// routes and the auth server's decision can legitimately differ between
+// them even for the same credentials.
+func (c *authCache) key(r *http.Request) string {
+	var b strings.Builder
+
+	b.WriteString(r.Method)
+	b.WriteByte('\x00')
+	b.WriteString(r.URL.Path)
+	b.WriteByte('\x00')
+
+	headers := c.keyHeaders
+	if len(headers) == 0 {
+		headers = []string{"Authorization"}
+	}
+
+	for _, header := range headers {
+		b.WriteString(r.Header.Get(header))
+		b.WriteByte('\x00')
+	}
+
+	if c.includeIP {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+		b.WriteString(ip)
+	}
+
+	return b.String()
+}
+
+func (c *authCache) report(event CacheEvent) {
+	if c.onEvent != nil {
+		c.onEvent(event)
+	}
+}
+
+func (c *authCache) get(key string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.report(CacheMiss)
+		return cacheEntry{}, false
+	}
+
+	entry := el.Value.(*cacheListEntry).entry
+	if time.Now().After(entry.expiresAt) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		c.report(CacheMiss)
+		return cacheEntry{}, false
+	}
+
+	c.ll.MoveToFront(el)
+	c.report(CacheHit)
+	return entry, true
+}
+
+// store caches response as the decision for key, deriving the TTL from the
+// response's Cache-Control header and clamping it to [minTTL, maxTTL]. A
+// Cache-Control: no-store response is never cached. A negative (non-2xx)
+// decision is never cached when negativeTTL is zero, even if the response
+// itself carries a Cache-Control: max-age - that header only scopes a TTL
+// the operator has already opted into, it doesn't override the operator's
+// choice to disable negative caching outright.
+func (c *authCache) store(key string, statusCode int, header http.Header, body []byte, cacheControl string) {
+	isSuccess := statusCode >= 200 && statusCode < 300
+
+	var ttl time.Duration
+	if isSuccess {
+		ttl = c.maxTTL
+		if ttl < c.minTTL {
+			ttl = c.minTTL
+		}
+	} else {
+		ttl = c.negativeTTL
+	}
+
+	directives := parseCacheControl(cacheControl)
+	if directives.noStore {
+		return
+	}
+	if !isSuccess && c.negativeTTL <= 0 {
+		// Denial caching is disabled outright: don't let the response's own
+		// Cache-Control: max-age override that, or a denial would get
+		// cached for up to maxTTL (the positive-decision clamp) even
+		// though negativeTTL == 0 promises denials are never cached.
+		return
+	}
+	if ttl == 0 && !directives.hasMaxAge {
+		return
+	}
+
+	if directives.hasMaxAge {
+		ttl = directives.maxAge
+		if ttl < c.minTTL {
+			ttl = c.minTTL
+		}
+		if ttl > c.maxTTL {
+			ttl = c.maxTTL
+		}
+	}
+
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := cacheEntry{
+		statusCode: statusCode,
+		header:     header,
+		body:       body,
+		expiresAt:  time.Now().Add(ttl),
+	}
+
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cacheListEntry).entry = entry
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	el := c.ll.PushFront(&cacheListEntry{key: key, entry: entry})
+	c.items[key] = el
+
+	for c.ll.Len() > c.maxEntries {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			break
+		}
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheListEntry).key)
+	}
+}
+
+type cacheControlDirectives struct {
+	noStore   bool
+	hasMaxAge bool
+	maxAge    time.Duration
+}
+
+func parseCacheControl(value string) cacheControlDirectives {
+	var directives cacheControlDirectives
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+
+		switch {
+		case strings.EqualFold(part, "no-store"), strings.EqualFold(part, "no-cache"):
+			directives.noStore = true
+		case strings.HasPrefix(strings.ToLower(part), "max-age="):
+			if seconds, err := strconv.Atoi(part[len("max-age="):]); err == nil {
+				directives.hasMaxAge = true
+				directives.maxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	return directives
+}
@@ -0,0 +1,147 @@
+package traefik_forward_filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthCacheKeyIncludesMethodAndPath(t *testing.T) {
+	c := newAuthCache(&Config{})
+
+	allow := httptest.NewRequest(http.MethodGet, "/public", nil)
+	allow.Header.Set("Authorization", "Bearer token")
+
+	admin := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	admin.Header.Set("Authorization", "Bearer token")
+
+	if c.key(allow) == c.key(admin) {
+		t.Fatal("cache key must differ between paths for the same credentials")
+	}
+
+	post := httptest.NewRequest(http.MethodPost, "/public", nil)
+	post.Header.Set("Authorization", "Bearer token")
+
+	if c.key(allow) == c.key(post) {
+		t.Fatal("cache key must differ between methods for the same credentials")
+	}
+}
+
+func TestAuthCacheStoreAndGet(t *testing.T) {
+	c := newAuthCache(&Config{CacheMaxTTL: 10000})
+
+	r := httptest.NewRequest(http.MethodGet, "/public", nil)
+	key := c.key(r)
+
+	if _, ok := c.get(key); ok {
+		t.Fatal("expected a miss before store")
+	}
+
+	c.store(key, http.StatusOK, http.Header{"X-Auth-User": {"alice"}}, nil, "")
+
+	entry, ok := c.get(key)
+	if !ok {
+		t.Fatal("expected a hit after store")
+	}
+	if entry.statusCode != http.StatusOK {
+		t.Errorf("statusCode = %d, want %d", entry.statusCode, http.StatusOK)
+	}
+	if got := entry.header.Get("X-Auth-User"); got != "alice" {
+		t.Errorf("header X-Auth-User = %q, want %q", got, "alice")
+	}
+}
+
+func TestAuthCacheNegativeTTLZeroNeverCachesDenial(t *testing.T) {
+	c := newAuthCache(&Config{CacheMaxTTL: 10000})
+
+	r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	key := c.key(r)
+
+	c.store(key, http.StatusForbidden, http.Header{"Content-Type": {"application/json"}}, nil, "")
+
+	if _, ok := c.get(key); ok {
+		t.Fatal("expected denial not to be cached when CacheNegativeTTL is zero")
+	}
+}
+
+func TestAuthCacheNegativeTTLZeroIgnoresDenialMaxAge(t *testing.T) {
+	c := newAuthCache(&Config{CacheMaxTTL: 10000})
+
+	r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	key := c.key(r)
+
+	c.store(key, http.StatusForbidden, http.Header{"Content-Type": {"application/json"}}, nil, "max-age=30")
+
+	if _, ok := c.get(key); ok {
+		t.Fatal("expected denial not to be cached when CacheNegativeTTL is zero, even with an explicit Cache-Control: max-age")
+	}
+}
+
+func TestAuthCacheCachesDenialWithNegativeTTL(t *testing.T) {
+	c := newAuthCache(&Config{CacheMaxTTL: 10000, CacheNegativeTTL: 10000})
+
+	r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	key := c.key(r)
+
+	c.store(key, http.StatusForbidden, http.Header{"Content-Type": {"application/json"}}, nil, "")
+
+	entry, ok := c.get(key)
+	if !ok {
+		t.Fatal("expected denial to be cached when CacheNegativeTTL is set")
+	}
+	if entry.statusCode != http.StatusForbidden {
+		t.Errorf("statusCode = %d, want %d", entry.statusCode, http.StatusForbidden)
+	}
+}
+
+func TestAuthCacheStoresAndReplaysBody(t *testing.T) {
+	c := newAuthCache(&Config{CacheMaxTTL: 10000, CacheNegativeTTL: 10000})
+
+	r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	key := c.key(r)
+
+	c.store(key, http.StatusForbidden, http.Header{"Content-Type": {"application/json"}}, []byte(`{"error":"denied"}`), "")
+
+	entry, ok := c.get(key)
+	if !ok {
+		t.Fatal("expected a hit after store")
+	}
+	if got := string(entry.body); got != `{"error":"denied"}` {
+		t.Errorf("body = %q, want %q", got, `{"error":"denied"}`)
+	}
+}
+
+func TestAuthCacheStoreDefaultsToMaxTTLWhenMinTTLSet(t *testing.T) {
+	c := newAuthCache(&Config{CacheMinTTL: 2000, CacheMaxTTL: 10000})
+
+	r := httptest.NewRequest(http.MethodGet, "/public", nil)
+	key := c.key(r)
+
+	before := time.Now()
+	c.store(key, http.StatusOK, http.Header{}, nil, "")
+
+	entry, ok := c.get(key)
+	if !ok {
+		t.Fatal("expected a hit after store")
+	}
+
+	// A CacheMinTTL floor must not override the maxTTL-based default when
+	// the response carries no Cache-Control: max-age.
+	if ttl := entry.expiresAt.Sub(before); ttl < 9*time.Second {
+		t.Errorf("expiresAt implies ttl = %s, want close to CacheMaxTTL (10s)", ttl)
+	}
+}
+
+func TestAuthCacheStoreRespectsNoStore(t *testing.T) {
+	c := newAuthCache(&Config{CacheMaxTTL: 10000})
+
+	r := httptest.NewRequest(http.MethodGet, "/public", nil)
+	key := c.key(r)
+
+	c.store(key, http.StatusOK, http.Header{}, nil, "no-store")
+
+	if _, ok := c.get(key); ok {
+		t.Fatal("expected Cache-Control: no-store to suppress caching")
+	}
+}
@@ -0,0 +1,260 @@
+package traefik_forward_filter
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// expr is a small, dependency-free expression evaluator covering the CEL
+// subset this plugin's header rules need: dotted/bracketed field access,
+// string/number/bool literals, comparisons, and &&/||/!. It exists so the
+// plugin can stay free of a real CEL library, which Yaegi can't load.
+type expr interface {
+	eval(env *ruleEnv) (any, error)
+}
+
+// ruleEnv is the evaluation context exposed to rule expressions as req.*
+// and resp.*. resp is nil while evaluating RequestHeaderRules.
+type ruleEnv struct {
+	req  reqAttrs
+	resp *respAttrs
+}
+
+type reqAttrs struct {
+	Method  string
+	Path    string
+	Headers map[string][]string
+}
+
+type respAttrs struct {
+	Status  int
+	Headers map[string][]string
+}
+
+func compileExpr(source string) (expr, error) {
+	p := &exprParser{tokens: tokenizeExpr(source), source: source}
+
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("expr: unexpected trailing input in %q", source)
+	}
+
+	return e, nil
+}
+
+// --- literals and field access ---
+
+type literalExpr struct{ value any }
+
+func (e *literalExpr) eval(*ruleEnv) (any, error) { return e.value, nil }
+
+// fieldExpr resolves a dotted/bracketed path such as req.headers["X-Foo"]
+// or resp.status against the evaluation environment.
+type fieldExpr struct{ path []string }
+
+func (e *fieldExpr) eval(env *ruleEnv) (any, error) {
+	if len(e.path) == 0 {
+		return nil, fmt.Errorf("expr: empty field path")
+	}
+
+	switch e.path[0] {
+	case "req":
+		return resolveAttrs(e.path[1:], e.path, reqAttrsFields(env.req))
+	case "resp":
+		if env.resp == nil {
+			return nil, nil
+		}
+		return resolveAttrs(e.path[1:], e.path, respAttrsFields(*env.resp))
+	default:
+		return nil, fmt.Errorf("expr: unknown identifier %q", e.path[0])
+	}
+}
+
+func reqAttrsFields(r reqAttrs) map[string]any {
+	return map[string]any{
+		"method":  r.Method,
+		"path":    r.Path,
+		"headers": r.Headers,
+	}
+}
+
+func respAttrsFields(r respAttrs) map[string]any {
+	return map[string]any{
+		"status":  float64(r.Status),
+		"headers": r.Headers,
+	}
+}
+
+func resolveAttrs(rest []string, fullPath []string, fields map[string]any) (any, error) {
+	if len(rest) == 0 {
+		return nil, fmt.Errorf("expr: incomplete field path %q", strings.Join(fullPath, "."))
+	}
+
+	v, ok := fields[rest[0]]
+	if !ok {
+		return nil, fmt.Errorf("expr: unknown field %q", strings.Join(fullPath, "."))
+	}
+
+	if len(rest) == 1 {
+		return v, nil
+	}
+
+	headers, ok := v.(map[string][]string)
+	if !ok {
+		return nil, fmt.Errorf("expr: %q is not indexable", strings.Join(fullPath[:len(fullPath)-len(rest)+1], "."))
+	}
+
+	values := headers[http.CanonicalHeaderKey(rest[1])]
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	return strings.Join(values, ", "), nil
+}
+
+// --- unary/binary operators ---
+
+type notExpr struct{ operand expr }
+
+func (e *notExpr) eval(env *ruleEnv) (any, error) {
+	v, err := e.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(v), nil
+}
+
+type binaryExpr struct {
+	op          string
+	left, right expr
+}
+
+func (e *binaryExpr) eval(env *ruleEnv) (any, error) {
+	switch e.op {
+	case "&&":
+		l, err := e.left.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if !truthy(l) {
+			return false, nil
+		}
+		r, err := e.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		return truthy(r), nil
+	case "||":
+		l, err := e.left.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if truthy(l) {
+			return true, nil
+		}
+		r, err := e.right.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		return truthy(r), nil
+	}
+
+	l, err := e.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	r, err := e.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return compare(e.op, l, r)
+}
+
+func compare(op string, l, r any) (any, error) {
+	if lf, lok := toFloat(l); lok {
+		if rf, rok := toFloat(r); rok {
+			switch op {
+			case "==":
+				return lf == rf, nil
+			case "!=":
+				return lf != rf, nil
+			case "<":
+				return lf < rf, nil
+			case "<=":
+				return lf <= rf, nil
+			case ">":
+				return lf > rf, nil
+			case ">=":
+				return lf >= rf, nil
+			}
+		}
+	}
+
+	ls, lok := l.(string)
+	rs, rok := r.(string)
+	if lok && rok {
+		switch op {
+		case "==":
+			return ls == rs, nil
+		case "!=":
+			return ls != rs, nil
+		case "<":
+			return ls < rs, nil
+		case "<=":
+			return ls <= rs, nil
+		case ">":
+			return ls > rs, nil
+		case ">=":
+			return ls >= rs, nil
+		}
+	}
+
+	switch op {
+	case "==", "!=":
+		if !isComparable(l) || !isComparable(r) {
+			return nil, fmt.Errorf("expr: cannot compare %v %s %v", l, op, r)
+		}
+		if op == "==" {
+			return l == r, nil
+		}
+		return l != r, nil
+	default:
+		return nil, fmt.Errorf("expr: cannot compare %v %s %v", l, op, r)
+	}
+}
+
+// isComparable reports whether v's dynamic type supports Go's == operator.
+// Field accesses like req.headers/resp.headers yield map[string][]string,
+// which panics on == instead of erroring, so we guard against it here.
+func isComparable(v any) bool {
+	switch v.(type) {
+	case map[string][]string:
+		return false
+	default:
+		return true
+	}
+}
+
+func truthy(v any) bool {
+	switch t := v.(type) {
+	case bool:
+		return t
+	case string:
+		return t != ""
+	case float64:
+		return t != 0
+	default:
+		return v != nil
+	}
+}
+
+func toFloat(v any) (float64, bool) {
+	f, ok := v.(float64)
+	return f, ok
+}
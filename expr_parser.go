@@ -0,0 +1,291 @@
+package traefik_forward_filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type exprTokenKind int
+
+const (
+	exprTokEOF exprTokenKind = iota
+	exprTokIdent
+	exprTokString
+	exprTokNumber
+	exprTokOp
+	exprTokLParen
+	exprTokRParen
+	exprTokLBracket
+	exprTokRBracket
+	exprTokDot
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+}
+
+// tokenizeExpr splits source into the small token set compileExpr needs:
+// identifiers, string/number literals, ()/[]/., and the comparison/logical
+// operators.
+func tokenizeExpr(source string) []exprToken {
+	var tokens []exprToken
+
+	runes := []rune(source)
+	i := 0
+
+	for i < len(runes) {
+		c := runes[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, exprToken{exprTokLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, exprToken{exprTokRParen, ")"})
+			i++
+		case c == '[':
+			tokens = append(tokens, exprToken{exprTokLBracket, "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, exprToken{exprTokRBracket, "]"})
+			i++
+		case c == '.':
+			tokens = append(tokens, exprToken{exprTokDot, "."})
+			i++
+		case c == '"' || c == '\'':
+			quote := c
+			j := i + 1
+			var b strings.Builder
+			for j < len(runes) && runes[j] != quote {
+				b.WriteRune(runes[j])
+				j++
+			}
+			tokens = append(tokens, exprToken{exprTokString, b.String()})
+			i = j + 1
+		case c == '&' && i+1 < len(runes) && runes[i+1] == '&':
+			tokens = append(tokens, exprToken{exprTokOp, "&&"})
+			i += 2
+		case c == '|' && i+1 < len(runes) && runes[i+1] == '|':
+			tokens = append(tokens, exprToken{exprTokOp, "||"})
+			i += 2
+		case c == '!' && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, exprToken{exprTokOp, "!="})
+			i += 2
+		case c == '!':
+			tokens = append(tokens, exprToken{exprTokOp, "!"})
+			i++
+		case c == '=' && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, exprToken{exprTokOp, "=="})
+			i += 2
+		case c == '<' && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, exprToken{exprTokOp, "<="})
+			i += 2
+		case c == '>' && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, exprToken{exprTokOp, ">="})
+			i += 2
+		case c == '<':
+			tokens = append(tokens, exprToken{exprTokOp, "<"})
+			i++
+		case c == '>':
+			tokens = append(tokens, exprToken{exprTokOp, ">"})
+			i++
+		case isExprIdentStart(c):
+			j := i + 1
+			for j < len(runes) && isExprIdentPart(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, exprToken{exprTokIdent, string(runes[i:j])})
+			i = j
+		case isExprDigit(c):
+			j := i + 1
+			for j < len(runes) && (isExprDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, exprToken{exprTokNumber, string(runes[i:j])})
+			i = j
+		default:
+			// Unrecognized characters are kept as an operator token that no
+			// grammar rule accepts, so parsePrimary or compileExpr's trailing
+			// token check surfaces the resulting parse failure.
+			tokens = append(tokens, exprToken{exprTokOp, string(c)})
+			i++
+		}
+	}
+
+	return tokens
+}
+
+func isExprIdentStart(c rune) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isExprIdentPart(c rune) bool {
+	return isExprIdentStart(c) || isExprDigit(c)
+}
+
+func isExprDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+// exprParser is a small recursive-descent parser over the precedence chain
+// or -> and -> not -> comparison -> primary.
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	source string
+}
+
+func (p *exprParser) peek() exprToken {
+	if p.pos >= len(p.tokens) {
+		return exprToken{kind: exprTokEOF}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *exprParser) parseOr() (expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == exprTokOp && p.peek().text == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "||", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == exprTokOp && p.peek().text == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{op: "&&", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (expr, error) {
+	if p.peek().kind == exprTokOp && p.peek().text == "!" {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{operand: operand}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (expr, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().kind == exprTokOp {
+		switch p.peek().text {
+		case "==", "!=", "<", "<=", ">", ">=":
+			op := p.next().text
+			right, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			return &binaryExpr{op: op, left: left, right: right}, nil
+		}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) parsePrimary() (expr, error) {
+	tok := p.peek()
+
+	switch tok.kind {
+	case exprTokLParen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != exprTokRParen {
+			return nil, fmt.Errorf("expr: expected ')' in %q", p.source)
+		}
+		p.next()
+		return inner, nil
+	case exprTokString:
+		p.next()
+		return &literalExpr{value: tok.text}, nil
+	case exprTokNumber:
+		p.next()
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expr: invalid number %q", tok.text)
+		}
+		return &literalExpr{value: f}, nil
+	case exprTokIdent:
+		return p.parseIdentChain()
+	default:
+		return nil, fmt.Errorf("expr: unexpected token in %q", p.source)
+	}
+}
+
+func (p *exprParser) parseIdentChain() (expr, error) {
+	tok := p.next()
+
+	switch tok.text {
+	case "true":
+		return &literalExpr{value: true}, nil
+	case "false":
+		return &literalExpr{value: false}, nil
+	}
+
+	path := []string{tok.text}
+
+	for {
+		switch p.peek().kind {
+		case exprTokDot:
+			p.next()
+			if p.peek().kind != exprTokIdent {
+				return nil, fmt.Errorf("expr: expected identifier after '.' in %q", p.source)
+			}
+			path = append(path, p.next().text)
+		case exprTokLBracket:
+			p.next()
+			if p.peek().kind != exprTokString {
+				return nil, fmt.Errorf("expr: expected string index in %q", p.source)
+			}
+			path = append(path, p.next().text)
+			if p.peek().kind != exprTokRBracket {
+				return nil, fmt.Errorf("expr: expected ']' in %q", p.source)
+			}
+			p.next()
+		default:
+			return &fieldExpr{path: path}, nil
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package traefik_forward_filter
+
+import "testing"
+
+func evalExpr(t *testing.T, source string, env *ruleEnv) any {
+	t.Helper()
+
+	e, err := compileExpr(source)
+	if err != nil {
+		t.Fatalf("compileExpr(%q): %v", source, err)
+	}
+
+	v, err := e.eval(env)
+	if err != nil {
+		t.Fatalf("eval(%q): %v", source, err)
+	}
+
+	return v
+}
+
+func TestExprFieldAccess(t *testing.T) {
+	env := &ruleEnv{
+		req: reqAttrs{
+			Method:  "GET",
+			Path:    "/admin",
+			Headers: map[string][]string{"X-Foo": {"bar"}},
+		},
+		resp: &respAttrs{
+			Status:  200,
+			Headers: map[string][]string{"X-Auth-User": {"alice"}},
+		},
+	}
+
+	cases := []struct {
+		source string
+		want   any
+	}{
+		{`req.method`, "GET"},
+		{`req.path`, "/admin"},
+		{`req.headers["X-Foo"]`, "bar"},
+		{`req.headers["Missing"]`, ""},
+		{`resp.status`, float64(200)},
+		{`resp.headers["X-Auth-User"]`, "alice"},
+	}
+
+	for _, tc := range cases {
+		if got := evalExpr(t, tc.source, env); got != tc.want {
+			t.Errorf("eval(%q) = %v, want %v", tc.source, got, tc.want)
+		}
+	}
+}
+
+func TestExprRespNilWhileEvaluatingRequestRules(t *testing.T) {
+	env := &ruleEnv{req: reqAttrs{Method: "GET"}}
+
+	got := evalExpr(t, `resp.status`, env)
+	if got != nil {
+		t.Errorf("eval(resp.status) with nil resp = %v, want nil", got)
+	}
+}
+
+func TestExprComparisonsAndLogic(t *testing.T) {
+	env := &ruleEnv{
+		req: reqAttrs{Method: "GET", Path: "/admin"},
+		resp: &respAttrs{
+			Status: 200,
+		},
+	}
+
+	cases := []struct {
+		source string
+		want   bool
+	}{
+		{`req.method == "GET"`, true},
+		{`req.method != "GET"`, false},
+		{`resp.status == 200`, true},
+		{`req.path == "/admin" && resp.status == 200`, true},
+		{`req.path == "/other" || resp.status == 200`, true},
+		{`!(req.method == "GET")`, false},
+	}
+
+	for _, tc := range cases {
+		if got := evalExpr(t, tc.source, env); got != tc.want {
+			t.Errorf("eval(%q) = %v, want %v", tc.source, got, tc.want)
+		}
+	}
+}
+
+func TestCompileExprRejectsTrailingInput(t *testing.T) {
+	if _, err := compileExpr(`req.method == "GET" )`); err == nil {
+		t.Fatal("expected an error for trailing input, got nil")
+	}
+}
+
+func TestExprCompareMapValuedFieldsErrors(t *testing.T) {
+	env := &ruleEnv{
+		req: reqAttrs{Headers: map[string][]string{"X-Foo": {"bar"}}},
+		resp: &respAttrs{
+			Headers: map[string][]string{"X-Foo": {"bar"}},
+		},
+	}
+
+	cases := []string{
+		`req.headers == resp.headers`,
+		`req.headers != resp.headers`,
+	}
+
+	for _, source := range cases {
+		e, err := compileExpr(source)
+		if err != nil {
+			t.Fatalf("compileExpr(%q): %v", source, err)
+		}
+
+		if _, err := e.eval(env); err == nil {
+			t.Errorf("eval(%q) = nil error, want an error", source)
+		}
+	}
+}
@@ -3,7 +3,6 @@ package traefik_forward_filter
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"errors"
 	"io"
 	"log"
@@ -32,6 +31,101 @@ type Config struct {
 	ResponseHeaders    []string          `json:"responseHeaders,omitempty"`
 	FailurePolicy      string            `json:"failurePolicy,omitempty"`
 	FailureStatusCode  []int             `json:"failureStatusCode"`
+
+	// MaxRequestBodyBytes caps how much of the request body is forwarded to
+	// Address when RequestWithBody is set; next still receives the full body
+	// unless RequestBodyOverflowPolicy rejects it. Zero means unlimited.
+	MaxRequestBodyBytes int64 `json:"maxRequestBodyBytes,omitempty"`
+	// RequestBodyOverflowPolicy controls what happens once the body exceeds
+	// MaxRequestBodyBytes: RequestBodyOverflowTruncate (the default) or
+	// RequestBodyOverflowAbort.
+	RequestBodyOverflowPolicy string `json:"requestBodyOverflowPolicy,omitempty"`
+	// RequestBodySpillThresholdBytes is how much of the body bodySpool keeps
+	// in memory before overflowing to a temp file. Defaults to 1 MiB.
+	RequestBodySpillThresholdBytes int64 `json:"requestBodySpillThresholdBytes,omitempty"`
+
+	// UpgradeMode controls how Connection: Upgrade requests (e.g. WebSocket
+	// handshakes) are handled: UpgradeBypass or UpgradeAuthOnce. Empty
+	// leaves them on the normal per-request auth path.
+	UpgradeMode string `json:"upgradeMode,omitempty"`
+
+	// RequestHeaderRules conditionally set/append/delete headers on the
+	// request forwarded to Address, evaluated against req.*.
+	RequestHeaderRules []HeaderRule `json:"requestHeaderRules,omitempty"`
+	// ResponseHeaderRules conditionally set/append/delete headers on the
+	// request passed to next (a 2xx decision that lets the request through)
+	// or the response written back to the client (otherwise, including a
+	// 2xx that carries a body), evaluated against req.* and resp.*.
+	ResponseHeaderRules []HeaderRule `json:"responseHeaderRules,omitempty"`
+
+	// CacheEnabled turns on the in-process auth decision cache. Disabled by
+	// default: repeated requests always hit Address.
+	CacheEnabled bool `json:"cacheEnabled,omitempty"`
+	// CacheKeyHeaders lists the request headers that make up the cache key.
+	// Defaults to just Authorization.
+	CacheKeyHeaders []string `json:"cacheKeyHeaders,omitempty"`
+	// CacheIncludeClientIP folds the request's source IP into the cache key.
+	CacheIncludeClientIP bool `json:"cacheIncludeClientIP,omitempty"`
+	// CacheMinTTL/CacheMaxTTL (milliseconds) clamp the TTL honored from the
+	// auth response's Cache-Control: max-age, and bound the default TTL used
+	// when it sends none.
+	CacheMinTTL int `json:"cacheMinTTL,omitempty"`
+	CacheMaxTTL int `json:"cacheMaxTTL,omitempty"`
+	// CacheNegativeTTL (milliseconds) enables caching of non-2xx decisions.
+	// Zero (the default) never caches a denial.
+	CacheNegativeTTL int `json:"cacheNegativeTTL,omitempty"`
+	// CacheMaxEntries caps the number of cached decisions, evicting the
+	// least recently used entry once exceeded.
+	CacheMaxEntries int `json:"cacheMaxEntries,omitempty"`
+	// CacheMetrics, when set, is called on every cache lookup. It can only
+	// be wired up programmatically, not through the plugin's static config.
+	CacheMetrics func(CacheEvent) `json:"-"`
+
+	// MaxRetries is how many additional attempts doWithRetry makes after a
+	// network error or a RetryOnStatusCode response.
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// RetryOnStatusCode lists the auth response statuses that count as a
+	// retryable failure. Network errors are always retryable.
+	RetryOnStatusCode []int `json:"retryOnStatusCode,omitempty"`
+	// BackoffInitialMs/BackoffMaxMs bound the full-jitter backoff applied
+	// between retries. Defaults to DefaultBackoffInitial/DefaultBackoffMax.
+	BackoffInitialMs int `json:"backoffInitialMs,omitempty"`
+	BackoffMaxMs     int `json:"backoffMaxMs,omitempty"`
+	// ConsecutiveFailures trips the circuit breaker after this many
+	// back-to-back failures. Zero disables the breaker entirely.
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+	// OpenDurationMs is how long the breaker stays open before allowing
+	// HalfOpenProbes probe calls through.
+	OpenDurationMs int `json:"openDurationMs,omitempty"`
+	// HalfOpenProbes is how many concurrent calls the half-open breaker lets
+	// through while testing recovery.
+	HalfOpenProbes int `json:"halfOpenProbes,omitempty"`
+	// BreakerMetrics, when set, is called on every breaker state
+	// transition. Programmatic only, like CacheMetrics.
+	BreakerMetrics func(BreakerState) `json:"-"`
+
+	// MaxIdleConnsPerHost/MaxConnsPerHost/IdleConnTimeoutMs/
+	// DisableKeepAlives tune the connection pool used to reach an http(s)://
+	// or unix:// Address. The transport is always dedicated to this plugin
+	// instance, so these apply regardless of InsecureSkipVerify. A
+	// grpc(s):// Address uses its own HTTP/2 transport and ignores them.
+	MaxIdleConnsPerHost int  `json:"maxIdleConnsPerHost,omitempty"`
+	MaxConnsPerHost     int  `json:"maxConnsPerHost,omitempty"`
+	IdleConnTimeoutMs   int  `json:"idleConnTimeoutMs,omitempty"`
+	DisableKeepAlives   bool `json:"disableKeepAlives,omitempty"`
+	// DialTimeoutMs bounds a single dial to Address, separate from
+	// RequestTimeout which bounds the whole round trip.
+	DialTimeoutMs int `json:"dialTimeoutMs,omitempty"`
+	// ForceHTTP2 negotiates HTTP/2 to Address, using h2c when Address is
+	// plain http:// and standard ALPN negotiation over TLS otherwise.
+	ForceHTTP2 bool `json:"forceHTTP2,omitempty"`
+
+	// ClientCertFile/ClientKeyFile present a client certificate to Address
+	// for mTLS. RootCAFile, if set, replaces the system root pool used to
+	// verify Address's certificate.
+	ClientCertFile string `json:"clientCertFile,omitempty"`
+	ClientKeyFile  string `json:"clientKeyFile,omitempty"`
+	RootCAFile     string `json:"rootCAFile,omitempty"`
 }
 
 func CreateConfig() *Config {
@@ -40,9 +134,13 @@ func CreateConfig() *Config {
 
 type ForwardFilter struct {
 	Config
-	next   http.Handler
-	client *http.Client
-	u      url.URL
+	next                http.Handler
+	backend             Backend
+	u                   url.URL
+	cache               *authCache
+	requestHeaderRules  []compiledHeaderRule
+	responseHeaderRules []compiledHeaderRule
+	breaker             *circuitBreaker
 }
 
 var requestPool = sync.Pool{New: func() any {
@@ -64,21 +162,9 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 		timeout = DefaultForwardTimeout
 	}
 
-	client := &http.Client{
-		CheckRedirect: func(r *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-		Timeout: timeout,
-	}
-
-	if config.InsecureSkipVerify {
-		tr := http.DefaultTransport.(*http.Transport).Clone()
-
-		tr.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: true,
-		}
-
-		client.Transport = tr
+	backend, backendURL, err := newBackend(u, config, timeout)
+	if err != nil {
+		return nil, err
 	}
 
 	switch config.FailurePolicy {
@@ -89,24 +175,75 @@ func New(ctx context.Context, next http.Handler, config *Config, name string) (h
 		return nil, errors.New("illegal failurePolicy")
 	}
 
+	switch config.RequestBodyOverflowPolicy {
+	case "":
+		config.RequestBodyOverflowPolicy = RequestBodyOverflowTruncate
+	case RequestBodyOverflowTruncate, RequestBodyOverflowAbort:
+	default:
+		return nil, errors.New("illegal requestBodyOverflowPolicy")
+	}
+
+	switch config.UpgradeMode {
+	case "", UpgradeBypass, UpgradeAuthOnce:
+	default:
+		return nil, errors.New("illegal upgradeMode")
+	}
+
+	requestHeaderRules, err := compileHeaderRules(config.RequestHeaderRules)
+	if err != nil {
+		return nil, err
+	}
+
+	responseHeaderRules, err := compileHeaderRules(config.ResponseHeaderRules)
+	if err != nil {
+		return nil, err
+	}
+
 	config.RequestHeaders = canonicalHeaders(config.RequestHeaders)
 	config.ResponseHeaders = canonicalHeaders(config.ResponseHeaders)
+	config.CacheKeyHeaders = canonicalHeaders(config.CacheKeyHeaders)
 
 	if len(config.FailureStatusCode) == 0 {
 		config.FailureStatusCode = defaultFailureStatusCode
 	}
 
 	ff := &ForwardFilter{
-		Config: *config,
-		next:   next,
-		client: client,
-		u:      *u,
+		Config:              *config,
+		next:                next,
+		backend:             backend,
+		u:                   *backendURL,
+		requestHeaderRules:  requestHeaderRules,
+		responseHeaderRules: responseHeaderRules,
+	}
+
+	if config.CacheEnabled {
+		ff.cache = newAuthCache(config)
+	}
+
+	if config.ConsecutiveFailures > 0 {
+		ff.breaker = newCircuitBreaker(config)
 	}
 
 	return Remover(ff), nil
 }
 
 func (f *ForwardFilter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if f.UpgradeMode == UpgradeBypass && isUpgradeRequest(r.Header) {
+		f.next.ServeHTTP(rw, r)
+		return
+	}
+
+	var cacheKey string
+
+	if f.cache != nil {
+		cacheKey = f.cache.key(r)
+
+		if entry, ok := f.cache.get(cacheKey); ok {
+			f.serveFromCache(rw, r, entry)
+			return
+		}
+	}
+
 	forwardReq := requestPool.Get().(*http.Request)
 	defer func() {
 		forwardReq.Header = nil
@@ -132,24 +269,112 @@ func (f *ForwardFilter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if len(f.requestHeaderRules) > 0 {
+		applyHeaderRules(f.requestHeaderRules, &ruleEnv{req: requestAttrs(r)}, forwardReq.Header)
+	}
+
+	var rebuildForwardBody func() (io.ReadCloser, error)
+
 	if f.RequestWithBody {
-		buf := new(bytes.Buffer)
-		teeReader := io.TeeReader(r.Body, buf)
+		spool := newBodySpool(f.RequestBodySpillThresholdBytes)
+
+		// When the overflow policy is abort, stop reading (and spooling to
+		// disk) as soon as the body exceeds MaxRequestBodyBytes instead of
+		// draining it in full first, so an oversized body is actually
+		// bounded rather than merely rejected after the fact. r.Body itself
+		// is left open in that case, so the untruncated body can still be
+		// replayed downstream below.
+		limitedAbort := f.MaxRequestBodyBytes > 0 && f.RequestBodyOverflowPolicy == RequestBodyOverflowAbort
+		var bodyReader io.Reader = r.Body
+		if limitedAbort {
+			bodyReader = io.LimitReader(r.Body, f.MaxRequestBodyBytes+1)
+		}
+
+		_, copyErr := io.Copy(spool, bodyReader)
+		overflowed := limitedAbort && copyErr == nil && spool.Size() > f.MaxRequestBodyBytes
+		if !overflowed {
+			r.Body.Close()
+		}
+
+		if copyErr != nil {
+			spool.Close()
+			log.Println(copyErr.Error())
+
+			if f.FailurePolicy == FailureAbort {
+				rw.WriteHeader(http.StatusBadGateway)
+				return
+			}
+
+			r.Body = http.NoBody
+			f.next.ServeHTTP(rw, r)
+			return
+		}
+
+		defer spool.Close()
+
+		if overflowed {
+			log.Printf("request body of %d+ bytes exceeds maxRequestBodyBytes (%d)", spool.Size(), f.MaxRequestBodyBytes)
+
+			if f.FailurePolicy == FailureAbort {
+				r.Body.Close()
+				rw.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			// FailurePolicy only waives the auth call here, not the body
+			// forwarded downstream: stitch the already-spooled prefix back
+			// onto the still-open, unread remainder of r.Body so next sees
+			// the client's full, untruncated body.
+			spooled, err := spool.Reader()
+			if err != nil {
+				r.Body.Close()
+				rw.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			r.Body = multiReadCloser{io.MultiReader(spooled, r.Body), []io.Closer{spooled, r.Body}}
+			defer r.Body.Close()
+			f.next.ServeHTTP(rw, r)
+			return
+		}
+
+		rebuildForwardBody = func() (io.ReadCloser, error) {
+			body, err := spool.Reader()
+			if err != nil {
+				return nil, err
+			}
+			if f.MaxRequestBodyBytes > 0 {
+				return limitReadCloser{io.LimitReader(body, f.MaxRequestBodyBytes), body}, nil
+			}
+			return body, nil
+		}
+
+		var bodyErr error
+		forwardReq.Body, bodyErr = rebuildForwardBody()
+		if bodyErr != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
 
-		forwardReq.Body = io.NopCloser(teeReader)
 		forwardReq.Method = http.MethodPost
 
 		if ct := r.Header.Get("Content-Type"); ct != "" {
 			forwardReq.Header.Set("Content-Type", ct)
 		}
 
-		r.Body = io.NopCloser(buf)
+		replayBody, err := spool.Reader()
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		r.Body = replayBody
 		defer r.Body.Close()
 	}
 
 	var isPass bool
 
-	response, err := f.client.Do(forwardReq)
+	response, err := f.doWithRetry(forwardReq, rebuildForwardBody)
 	defer func() {
 		if isPass {
 			return
@@ -176,6 +401,13 @@ func (f *ForwardFilter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 			}
 		}
 
+		if len(f.responseHeaderRules) > 0 {
+			applyHeaderRules(f.responseHeaderRules, &ruleEnv{
+				req:  requestAttrs(r),
+				resp: &respAttrs{Status: response.StatusCode, Headers: response.Header},
+			}, rw.Header())
+		}
+
 		rw.WriteHeader(response.StatusCode)
 
 		if response.ContentLength > 0 {
@@ -188,26 +420,139 @@ func (f *ForwardFilter) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if f.cache != nil {
+		// Read the body into memory up front so it can be stored alongside
+		// the status/headers: a denial (or a 2xx meant to be written
+		// directly, per the ContentLength > 0 branch below) isn't fully
+		// described by its status code alone, and response.Body can only
+		// be read once.
+		var cacheBody []byte
+		if response.ContentLength != 0 {
+			body, readErr := io.ReadAll(response.Body)
+			closeErr := response.Body.Close()
+			if readErr == nil {
+				readErr = closeErr
+			}
+
+			if readErr != nil {
+				log.Println(readErr.Error())
+				response.Body = http.NoBody
+				response.ContentLength = 0
+			} else {
+				cacheBody = body
+				response.Body = io.NopCloser(bytes.NewReader(body))
+				response.ContentLength = int64(len(body))
+			}
+		}
+
+		// A FailureStatusCode response means Address itself failed, not
+		// that it denied the request, under either FailurePolicy: caching
+		// it would keep serving a stale failure for the full negative TTL
+		// even after Address recovers, instead of re-contacting it on the
+		// next request.
+		skipCache := f.isFailureStatus(response.StatusCode)
+
+		if !skipCache {
+			f.cache.store(cacheKey, response.StatusCode, response.Header, cacheBody, response.Header.Get("Cache-Control"))
+		}
+	}
+
 	if response.StatusCode >= 200 && response.StatusCode < 300 {
-		if response.ContentLength == 0 {
+		// UpgradeAuthOnce promises next gets the handshake untouched after
+		// this single auth call, so it can hijack the connection: an
+		// authorized upgrade request always passes through here, even if
+		// Address sent a body, instead of falling into the "write the auth
+		// response body directly" branch below and never reaching next.
+		if response.ContentLength == 0 || (f.UpgradeMode == UpgradeAuthOnce && isUpgradeRequest(r.Header)) {
 			for _, header := range f.ResponseHeaders {
 				if v := response.Header.Get(header); v != "" {
 					r.Header.Set(header, v)
 				}
 			}
 
+			if len(f.responseHeaderRules) > 0 {
+				applyHeaderRules(f.responseHeaderRules, &ruleEnv{
+					req:  requestAttrs(r),
+					resp: &respAttrs{Status: response.StatusCode, Headers: response.Header},
+				}, r.Header)
+			}
+
+			if response.ContentLength > 0 {
+				response.Body.Close()
+			}
+
 			isPass = true
 			f.next.ServeHTTP(rw, r)
 			return
 		}
 	}
 
+	if f.isFailureStatus(response.StatusCode) {
+		err = errors.New(response.Status)
+	}
+}
+
+// isFailureStatus reports whether code is one of f.FailureStatusCode, the
+// set of auth-response statuses FailurePolicy treats as an Address failure
+// rather than a denial.
+func (f *ForwardFilter) isFailureStatus(code int) bool {
 	for _, status := range f.FailureStatusCode {
-		if response.StatusCode == status {
-			err = errors.New(response.Status)
-			break
+		if code == status {
+			return true
 		}
 	}
+	return false
+}
+
+// serveFromCache replays a previously cached auth decision without calling
+// Address, mirroring the two outcomes ServeHTTP itself produces for a live
+// response (including the allowed ResponseHeaders, responseHeaderRules, and
+// the UpgradeAuthOnce bodied-2xx carve-out).
+func (f *ForwardFilter) serveFromCache(rw http.ResponseWriter, r *http.Request, entry cacheEntry) {
+	// A bodyless 2xx decision is the cache-hit mirror of ServeHTTP's
+	// pass-through branch; a bodied 2xx (or any non-2xx) mirrors its
+	// "respond directly" branch instead, since that body - e.g. a JSON
+	// denial payload - is what the client needs to see. The UpgradeAuthOnce
+	// exception mirrors ServeHTTP too: a bodied 2xx still passes through so
+	// the handshake reaches next instead of being answered with the stale
+	// auth-response body.
+	if entry.statusCode >= 200 && entry.statusCode < 300 &&
+		(len(entry.body) == 0 || (f.UpgradeMode == UpgradeAuthOnce && isUpgradeRequest(r.Header))) {
+		for _, header := range f.ResponseHeaders {
+			if v := entry.header.Get(header); v != "" {
+				r.Header.Set(header, v)
+			}
+		}
+
+		if len(f.responseHeaderRules) > 0 {
+			applyHeaderRules(f.responseHeaderRules, &ruleEnv{
+				req:  requestAttrs(r),
+				resp: &respAttrs{Status: entry.statusCode, Headers: entry.header},
+			}, r.Header)
+		}
+
+		f.next.ServeHTTP(rw, r)
+		return
+	}
+
+	for _, header := range f.ResponseHeaders {
+		if v := entry.header.Get(header); v != "" {
+			rw.Header().Set(header, v)
+		}
+	}
+
+	if len(f.responseHeaderRules) > 0 {
+		applyHeaderRules(f.responseHeaderRules, &ruleEnv{
+			req:  requestAttrs(r),
+			resp: &respAttrs{Status: entry.statusCode, Headers: entry.header},
+		}, rw.Header())
+	}
+
+	rw.WriteHeader(entry.statusCode)
+
+	if len(entry.body) > 0 {
+		rw.Write(entry.body)
+	}
 }
 
 func canonicalHeaders(headers []string) []string {
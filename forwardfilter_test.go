@@ -0,0 +1,450 @@
+package traefik_forward_filter
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestServeHTTPCacheHitReplaysDenialBody(t *testing.T) {
+	var authCalls int
+
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authCalls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"error":"denied"}`))
+	}))
+	defer auth.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next must not be called for a denied request")
+	})
+
+	handler, err := New(context.Background(), next, &Config{
+		Address:          auth.URL,
+		CacheEnabled:     true,
+		CacheMaxTTL:      10000,
+		CacheNegativeTTL: 10000,
+	}, "test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	do := func() *http.Response {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		handler.ServeHTTP(rw, req)
+		return rw.Result()
+	}
+
+	first := do()
+	if first.StatusCode != http.StatusForbidden {
+		t.Fatalf("first response status = %d, want %d", first.StatusCode, http.StatusForbidden)
+	}
+	firstBody, _ := io.ReadAll(first.Body)
+	if string(firstBody) != `{"error":"denied"}` {
+		t.Fatalf("first response body = %q, want %q", firstBody, `{"error":"denied"}`)
+	}
+
+	second := do()
+	if second.StatusCode != http.StatusForbidden {
+		t.Fatalf("cached response status = %d, want %d", second.StatusCode, http.StatusForbidden)
+	}
+	secondBody, _ := io.ReadAll(second.Body)
+	if string(secondBody) != `{"error":"denied"}` {
+		t.Fatalf("cached response body = %q, want %q (cache hit dropped the body)", secondBody, `{"error":"denied"}`)
+	}
+
+	if authCalls != 1 {
+		t.Fatalf("auth server was called %d times, want 1 (second request should be served from cache)", authCalls)
+	}
+}
+
+func TestServeHTTPCacheDoesNotStoreFailureStatusUnderIgnorePolicy(t *testing.T) {
+	var authCalls int
+
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authCalls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer auth.Close()
+
+	var nextCalls int
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalls++
+	})
+
+	handler, err := New(context.Background(), next, &Config{
+		Address:          auth.URL,
+		CacheEnabled:     true,
+		CacheMaxTTL:      10000,
+		CacheNegativeTTL: 10000,
+		FailurePolicy:    FailureIgnore,
+	}, "test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	do := func() {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		handler.ServeHTTP(rw, req)
+	}
+
+	do()
+	do()
+
+	if authCalls != 2 {
+		t.Fatalf("auth server was called %d times, want 2 (a FailureStatusCode response under FailurePolicy: ignore must never be cached)", authCalls)
+	}
+	if nextCalls != 2 {
+		t.Fatalf("next was called %d times, want 2 (FailurePolicy: ignore should fail open on every request)", nextCalls)
+	}
+}
+
+func TestServeHTTPCacheDoesNotStoreFailureStatusUnderAbortPolicy(t *testing.T) {
+	var authCalls int
+
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authCalls++
+		if authCalls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer auth.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	handler, err := New(context.Background(), next, &Config{
+		Address:          auth.URL,
+		CacheEnabled:     true,
+		CacheMaxTTL:      10000,
+		CacheNegativeTTL: 10000,
+		FailurePolicy:    FailureAbort,
+	}, "test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	do := func() *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		handler.ServeHTTP(rw, req)
+		return rw
+	}
+
+	rw1 := do()
+	if rw1.Code != http.StatusServiceUnavailable {
+		t.Fatalf("first response status = %d, want %d", rw1.Code, http.StatusServiceUnavailable)
+	}
+
+	rw2 := do()
+	if rw2.Code != http.StatusOK {
+		t.Fatalf("second response status = %d, want %d (Address recovered, but a cached FailureStatusCode would keep serving 503)", rw2.Code, http.StatusOK)
+	}
+
+	if authCalls != 2 {
+		t.Fatalf("auth server was called %d times, want 2 (a FailureStatusCode response must never be cached, regardless of FailurePolicy)", authCalls)
+	}
+}
+
+func TestServeHTTPCacheHitUpgradeAuthOnceReachesNextOnBodied2xx(t *testing.T) {
+	var authCalls int
+
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authCalls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer auth.Close()
+
+	var nextCalls int
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextCalls++
+	})
+
+	handler, err := New(context.Background(), next, &Config{
+		Address:          auth.URL,
+		CacheEnabled:     true,
+		CacheMaxTTL:      10000,
+		CacheNegativeTTL: 10000,
+		UpgradeMode:      UpgradeAuthOnce,
+	}, "test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	do := func() {
+		rw := httptest.NewRecorder()
+		req := upgradeRequest()
+		handler.ServeHTTP(rw, req)
+	}
+
+	do()
+	do()
+
+	if authCalls != 1 {
+		t.Fatalf("auth server was called %d times, want 1 (second handshake should be served from cache)", authCalls)
+	}
+	if nextCalls != 2 {
+		t.Fatalf("next was called %d times, want 2 (a cached bodied-2xx auth-once decision must still reach next for the handshake)", nextCalls)
+	}
+}
+
+func TestServeHTTPAbortOverflowIgnoreForwardsFullBody(t *testing.T) {
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("auth server must not be called once the body overflows in abort mode")
+	}))
+	defer auth.Close()
+
+	wantBody := make([]byte, 100)
+	for i := range wantBody {
+		wantBody[i] = byte('a' + i%26)
+	}
+
+	var gotBody []byte
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		gotBody, err = io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("next: read body: %v", err)
+		}
+	})
+
+	handler, err := New(context.Background(), next, &Config{
+		Address:                   auth.URL,
+		RequestWithBody:           true,
+		MaxRequestBodyBytes:       4,
+		RequestBodyOverflowPolicy: RequestBodyOverflowAbort,
+		FailurePolicy:             FailureIgnore,
+	}, "test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(wantBody))
+	handler.ServeHTTP(rw, req)
+
+	if string(gotBody) != string(wantBody) {
+		t.Fatalf("next received %d bytes, want %d bytes (oversized body was truncated instead of forwarded in full)", len(gotBody), len(wantBody))
+	}
+}
+
+func TestServeHTTPAbortOverflowAbortRejectsWith413(t *testing.T) {
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("auth server must not be called once the body overflows in abort mode")
+	}))
+	defer auth.Close()
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("next must not be called once the body overflows under FailurePolicy: abort")
+	})
+
+	handler, err := New(context.Background(), next, &Config{
+		Address:                   auth.URL,
+		RequestWithBody:           true,
+		MaxRequestBodyBytes:       4,
+		RequestBodyOverflowPolicy: RequestBodyOverflowAbort,
+		FailurePolicy:             FailureAbort,
+	}, "test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(make([]byte, 100)))
+	handler.ServeHTTP(rw, req)
+
+	if rw.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("response status = %d, want %d", rw.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestServeHTTPTruncateOverflowBoundsAddressBodyButForwardsFullBodyToNext(t *testing.T) {
+	var gotAuthBody []byte
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		gotAuthBody, err = io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("auth server: read body: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer auth.Close()
+
+	wantBody := make([]byte, 100)
+	for i := range wantBody {
+		wantBody[i] = byte('a' + i%26)
+	}
+
+	var gotNextBody []byte
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		gotNextBody, err = io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("next: read body: %v", err)
+		}
+	})
+
+	handler, err := New(context.Background(), next, &Config{
+		Address:             auth.URL,
+		RequestWithBody:     true,
+		MaxRequestBodyBytes: 4,
+	}, "test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(wantBody))
+	handler.ServeHTTP(rw, req)
+
+	if string(gotAuthBody) != string(wantBody[:4]) {
+		t.Fatalf("auth server received %q, want %q (bounded prefix)", gotAuthBody, wantBody[:4])
+	}
+	if string(gotNextBody) != string(wantBody) {
+		t.Fatalf("next received %d bytes, want %d bytes (truncate policy should still forward the full body downstream)", len(gotNextBody), len(wantBody))
+	}
+}
+
+func TestServeHTTPHeaderRulesAppliedLiveAndOnCacheHit(t *testing.T) {
+	var authCalls int
+
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authCalls++
+		if got := r.Header.Get("X-From-Path"); got != "/admin" {
+			t.Errorf("auth server saw X-From-Path = %q, want %q", got, "/admin")
+		}
+		w.Header().Set("X-Auth-User", "alice")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer auth.Close()
+
+	var nextHeaders []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nextHeaders = append(nextHeaders, r.Header.Get("X-User"))
+	})
+
+	handler, err := New(context.Background(), next, &Config{
+		Address:          auth.URL,
+		CacheEnabled:     true,
+		CacheMaxTTL:      10000,
+		CacheNegativeTTL: 10000,
+		RequestHeaderRules: []HeaderRule{
+			{Set: "X-From-Path", Value: "req.path"},
+		},
+		ResponseHeaderRules: []HeaderRule{
+			{When: `resp.status == 200`, Set: "X-User", Value: `resp.headers["X-Auth-User"]`},
+		},
+	}, "test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	do := func() {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		handler.ServeHTTP(rw, req)
+	}
+
+	do()
+	do()
+
+	if authCalls != 1 {
+		t.Fatalf("auth server was called %d times, want 1 (second request should be served from cache)", authCalls)
+	}
+
+	if len(nextHeaders) != 2 || nextHeaders[0] != "alice" || nextHeaders[1] != "alice" {
+		t.Fatalf("next saw X-User = %v, want [alice alice] on both the live and cache-hit requests", nextHeaders)
+	}
+}
+
+func upgradeRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	return req
+}
+
+func TestServeHTTPUpgradeBypassNeverCallsAuth(t *testing.T) {
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("auth server must not be called for an UpgradeBypass request")
+	}))
+	defer auth.Close()
+
+	var gotHeader http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+	})
+
+	handler, err := New(context.Background(), next, &Config{
+		Address:     auth.URL,
+		UpgradeMode: UpgradeBypass,
+	}, "test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	rw := httptest.NewRecorder()
+	req := upgradeRequest()
+	handler.ServeHTTP(rw, req)
+
+	if gotHeader == nil {
+		t.Fatal("next was not called")
+	}
+	if got := gotHeader.Get("Upgrade"); got != "websocket" {
+		t.Fatalf("Upgrade header = %q, want %q", got, "websocket")
+	}
+	if got := gotHeader.Get("Sec-WebSocket-Key"); got != "dGhlIHNhbXBsZSBub25jZQ==" {
+		t.Fatalf("Sec-WebSocket-Key header = %q, want preserved", got)
+	}
+}
+
+func TestServeHTTPUpgradeAuthOnceReachesNextOnBodied2xx(t *testing.T) {
+	auth := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer auth.Close()
+
+	var gotHeader http.Header
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+	})
+
+	handler, err := New(context.Background(), next, &Config{
+		Address:     auth.URL,
+		UpgradeMode: UpgradeAuthOnce,
+	}, "test")
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	rw := httptest.NewRecorder()
+	req := upgradeRequest()
+	handler.ServeHTTP(rw, req)
+
+	if gotHeader == nil {
+		t.Fatal("next was not reached: a bodied 2xx from the auth server stopped an auth-once upgrade from passing through")
+	}
+	if got := gotHeader.Get("Connection"); got != "Upgrade" {
+		t.Fatalf("Connection header = %q, want %q", got, "Upgrade")
+	}
+	if got := gotHeader.Get("Upgrade"); got != "websocket" {
+		t.Fatalf("Upgrade header = %q, want %q", got, "websocket")
+	}
+	if got := gotHeader.Get("Sec-WebSocket-Key"); got != "dGhlIHNhbXBsZSBub25jZQ==" {
+		t.Fatalf("Sec-WebSocket-Key header = %q, want preserved", got)
+	}
+}
@@ -0,0 +1,310 @@
+package traefik_forward_filter
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// checkMethodPath is the gRPC method path for the Envoy ext_authz v3 Check
+// RPC.
+const checkMethodPath = "/envoy.service.auth.v3.Authorization/Check"
+
+// grpcBackend speaks the Envoy ext_authz v3 Check RPC, so operators can
+// reuse an existing OPA/ext_authz sidecar as the auth Address instead of
+// standing up an HTTP shim in front of it.
+//
+// It does its own gRPC framing over http2.Transport and hand-encodes the
+// CheckRequest/CheckResponse messages (see pbwire.go) instead of going
+// through google.golang.org/grpc and envoyproxy/go-control-plane's
+// generated types: that dependency tree leans on reflection and unsafe in
+// google.golang.org/protobuf/internal/impl that Yaegi, the interpreter
+// Traefik uses to load plugins from source, cannot run, which would have
+// risked breaking the whole plugin's load, not just this backend.
+type grpcBackend struct {
+	transport *http2.Transport
+	target    *url.URL
+	timeout   time.Duration
+}
+
+func newGRPCBackend(u *url.URL, config *Config, timeout time.Duration) (*grpcBackend, *url.URL, error) {
+	scheme := "http"
+	useTLS := u.Scheme == "grpcs"
+	var tlsConfig *tls.Config
+
+	if useTLS {
+		scheme = "https"
+
+		var err error
+		tlsConfig, err = buildTLSConfig(config)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	dialer := &net.Dialer{}
+	if config.DialTimeoutMs > 0 {
+		dialer.Timeout = time.Duration(config.DialTimeoutMs) * time.Millisecond
+	}
+
+	backend := &grpcBackend{
+		transport: &http2.Transport{
+			AllowHTTP:       true,
+			TLSClientConfig: tlsConfig,
+			// cfg is never nil here even for a plaintext grpc:// address:
+			// http2.Transport builds one itself before calling DialTLSContext.
+			// useTLS, not cfg's nilness, is what tells a real TLS dial apart
+			// from a plaintext h2c one.
+			DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+				conn, err := dialer.DialContext(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				if !useTLS {
+					return conn, nil
+				}
+				return tls.Client(conn, cfg), nil
+			},
+		},
+		target:  &url.URL{Scheme: scheme, Host: u.Host},
+		timeout: timeout,
+	}
+
+	// New is called again on every Traefik dynamic config change, and
+	// nothing in the plugin lifecycle gives us a shutdown hook to release
+	// the previous backend's pooled connections. Closing them once this
+	// backend becomes unreachable keeps a config reload from leaking a
+	// connection on every change.
+	runtime.SetFinalizer(backend, (*grpcBackend).Close)
+
+	return backend, &url.URL{Scheme: "grpc", Host: u.Host}, nil
+}
+
+// Do translates forwardReq into an ext_authz CheckRequest and the resulting
+// Ok/Denied response back into an *http.Response, so ServeHTTP can treat a
+// gRPC backend exactly like an HTTP one.
+func (b *grpcBackend) Do(forwardReq *http.Request) (*http.Response, error) {
+	// The Check RPC only carries headers (see encodeCheckRequest below),
+	// never a body, so forwardReq.Body - built and possibly disk-backed by
+	// ServeHTTP when RequestWithBody is set - would otherwise never be read
+	// or closed, unlike the HTTP backends where http.Client.Do does that
+	// for us.
+	if forwardReq.Body != nil {
+		defer forwardReq.Body.Close()
+	}
+
+	checkRequest := encodeCheckRequest(forwardReq)
+
+	ctx := forwardReq.Context()
+	if b.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.target.String()+checkMethodPath, bytes.NewReader(grpcFrame(checkRequest)))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(5 + len(checkRequest))
+	req.Header.Set("content-type", "application/grpc")
+	req.Header.Set("te", "trailers")
+
+	resp, err := b.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// An intermediary in front of the ext_authz sidecar (proxy/LB) can
+		// answer at the HTTP level without ever reaching gRPC, so there's
+		// no grpc-status to check below: treat a non-200 HTTP status as a
+		// backend failure rather than falling through and unframing
+		// whatever body it sent as if it were a CheckResponse.
+		return nil, fmt.Errorf("ext_authz Check: unexpected HTTP status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if status := grpcStatus(resp); status != "" && status != "0" {
+		return nil, fmt.Errorf("ext_authz Check: grpc-status %s: %s", status, grpcMessage(resp))
+	}
+
+	msg, err := unframeGRPCMessage(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return checkResponseToHTTP(msg), nil
+}
+
+// encodeCheckRequest builds the wire bytes of a CheckRequest carrying just
+// the attributes.request.http fields ext_authz implementations key
+// decisions off: method/headers/path/host/scheme.
+func encodeCheckRequest(forwardReq *http.Request) []byte {
+	var httpReq []byte
+	httpReq = appendString(httpReq, 2, forwardReq.Header.Get(xForwardedMethod)) // method
+	for name, values := range forwardReq.Header {
+		httpReq = appendMapEntry(httpReq, 3, strings.ToLower(name), strings.Join(values, ",")) // headers
+	}
+	httpReq = appendString(httpReq, 4, forwardReq.Header.Get(XForwardedUri))   // path
+	httpReq = appendString(httpReq, 5, forwardReq.Header.Get(XForwardedHost))  // host
+	httpReq = appendString(httpReq, 6, forwardReq.Header.Get(XForwardedProto)) // scheme
+
+	var request []byte
+	request = appendBytes(request, 2, httpReq) // AttributeContext_Request.http
+
+	var attributes []byte
+	attributes = appendBytes(attributes, 4, request) // AttributeContext.request
+
+	var checkRequest []byte
+	checkRequest = appendBytes(checkRequest, 1, attributes) // CheckRequest.attributes
+
+	return checkRequest
+}
+
+// checkResponseToHTTP decodes a CheckResponse's oneof status (field 2:
+// denied_response, field 3: ok_response) into an *http.Response.
+func checkResponseToHTTP(msg []byte) *http.Response {
+	header := make(http.Header)
+
+	for _, f := range pbFields(msg) {
+		switch f.num {
+		case 2: // denied_response
+			return deniedResponseToHTTP(f.bytes)
+		case 3: // ok_response
+			for _, hf := range pbFields(f.bytes) {
+				if hf.num == 2 { // headers
+					applyHeaderValueOptions(header, hf.bytes)
+				}
+			}
+			return &http.Response{StatusCode: http.StatusOK, Header: header, Body: http.NoBody}
+		}
+	}
+
+	return &http.Response{StatusCode: http.StatusOK, Header: header, Body: http.NoBody}
+}
+
+func deniedResponseToHTTP(msg []byte) *http.Response {
+	header := make(http.Header)
+	var statusCode int
+	var body string
+
+	for _, f := range pbFields(msg) {
+		switch f.num {
+		case 1: // status (HttpStatus)
+			for _, sf := range pbFields(f.bytes) {
+				if sf.num == 1 && sf.wireType == 0 { // code
+					statusCode = int(sf.varint)
+				}
+			}
+		case 2: // headers
+			applyHeaderValueOptions(header, f.bytes)
+		case 3: // body
+			body = string(f.bytes)
+		}
+	}
+
+	if statusCode == 0 {
+		statusCode = http.StatusForbidden
+	}
+
+	return &http.Response{
+		StatusCode:    statusCode,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+// applyHeaderValueOptions decodes a repeated HeaderValueOption field (each
+// wrapping a HeaderValue at field 1) and sets every key/value it finds.
+func applyHeaderValueOptions(header http.Header, msg []byte) {
+	for _, f := range pbFields(msg) {
+		if f.num != 1 { // header
+			continue
+		}
+
+		var key, value string
+		for _, hf := range pbFields(f.bytes) {
+			switch hf.num {
+			case 1:
+				key = string(hf.bytes)
+			case 2:
+				value = string(hf.bytes)
+			}
+		}
+		if key != "" {
+			header.Set(key, value)
+		}
+	}
+}
+
+// grpcFrame wraps msg in gRPC's length-prefixed message framing: a 1-byte
+// compression flag (always 0, uncompressed) followed by a 4-byte
+// big-endian length.
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(msg)))
+	copy(frame[5:], msg)
+	return frame
+}
+
+// unframeGRPCMessage strips the gRPC length-prefix from a unary response
+// body and returns the single message it carries. An empty body (e.g. a
+// trailers-only error response) yields a nil message.
+func unframeGRPCMessage(body []byte) ([]byte, error) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+	if len(body) < 5 {
+		return nil, fmt.Errorf("ext_authz Check: truncated gRPC frame")
+	}
+	if body[0] != 0 {
+		return nil, fmt.Errorf("ext_authz Check: compressed gRPC responses are not supported")
+	}
+
+	length := binary.BigEndian.Uint32(body[1:5])
+	if uint64(len(body)-5) < uint64(length) {
+		return nil, fmt.Errorf("ext_authz Check: truncated gRPC frame")
+	}
+
+	return body[5 : 5+length], nil
+}
+
+// grpcStatus/grpcMessage read the grpc-status/grpc-message that report the
+// RPC outcome. They arrive as HTTP/2 trailers after a normal response, or
+// as plain headers on a trailers-only response (e.g. an immediate error).
+func grpcStatus(resp *http.Response) string {
+	if s := resp.Trailer.Get("grpc-status"); s != "" {
+		return s
+	}
+	return resp.Header.Get("grpc-status")
+}
+
+func grpcMessage(resp *http.Response) string {
+	if m := resp.Trailer.Get("grpc-message"); m != "" {
+		return m
+	}
+	return resp.Header.Get("grpc-message")
+}
+
+func (b *grpcBackend) Close() error {
+	b.transport.CloseIdleConnections()
+	return nil
+}
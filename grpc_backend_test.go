@@ -0,0 +1,245 @@
+package traefik_forward_filter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// newCheckTestServer starts a plaintext (h2c) HTTP/2 server that decodes an
+// incoming CheckRequest frame and replies with whatever respMsg handler
+// returns, framed the same way a real ext_authz sidecar would.
+func newCheckTestServer(t *testing.T, handler func(checkRequest []byte) []byte) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(checkMethodPath, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading request body: %v", err)
+			return
+		}
+
+		msg, err := unframeGRPCMessage(body)
+		if err != nil {
+			t.Errorf("unframeGRPCMessage: %v", err)
+			return
+		}
+
+		w.Header().Set("content-type", "application/grpc")
+		w.Write(grpcFrame(handler(msg)))
+	})
+
+	server := httptest.NewUnstartedServer(h2c.NewHandler(mux, &http2.Server{}))
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func dial(t *testing.T, rawURL string) (*grpcBackend, *http.Request) {
+	t.Helper()
+
+	u := mustParseURL(t, rawURL)
+
+	backend, _, err := newGRPCBackend(u, &Config{}, time.Second)
+	if err != nil {
+		t.Fatalf("newGRPCBackend: %v", err)
+	}
+
+	forwardReq, err := http.NewRequest(http.MethodGet, "http://example.com/admin", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest: %v", err)
+	}
+	forwardReq.Header.Set(xForwardedMethod, http.MethodGet)
+	forwardReq.Header.Set(XForwardedHost, "example.com")
+	forwardReq.Header.Set(XForwardedUri, "/admin")
+	forwardReq.Header.Set(XForwardedProto, "http")
+	forwardReq.Header.Set("Authorization", "Bearer token")
+
+	return backend, forwardReq
+}
+
+func TestGRPCBackendDoReturnsOkResponse(t *testing.T) {
+	server := newCheckTestServer(t, func(checkRequest []byte) []byte {
+		var okResponse []byte
+		// headers (field 2) is a HeaderValueOption whose field 1 is a
+		// HeaderValue{1: key, 2: value}, the same shape appendMapEntry builds.
+		okResponse = appendBytes(okResponse, 2, appendMapEntry(nil, 1, "x-auth-user", "alice"))
+
+		var resp []byte
+		resp = appendBytes(resp, 3, okResponse) // ok_response
+		return resp
+	})
+
+	backend, forwardReq := dial(t, "grpc://"+server.Listener.Addr().String())
+
+	resp, err := backend.Do(forwardReq)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if got := resp.Header.Get("X-Auth-User"); got != "alice" {
+		t.Errorf("X-Auth-User = %q, want %q", got, "alice")
+	}
+}
+
+func TestGRPCBackendDoReturnsDeniedResponseWithBody(t *testing.T) {
+	server := newCheckTestServer(t, func(checkRequest []byte) []byte {
+		var httpStatus []byte
+		httpStatus = appendVarint(appendTag(httpStatus, 1, 0), http.StatusForbidden)
+
+		var deniedResponse []byte
+		deniedResponse = appendBytes(deniedResponse, 1, httpStatus)
+		deniedResponse = appendString(deniedResponse, 3, `{"error":"denied"}`)
+
+		var resp []byte
+		resp = appendBytes(resp, 2, deniedResponse) // denied_response
+		return resp
+	})
+
+	backend, forwardReq := dial(t, "grpc://"+server.Listener.Addr().String())
+
+	resp, err := backend.Do(forwardReq)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusForbidden)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(body) != `{"error":"denied"}` {
+		t.Errorf("body = %q, want %q", body, `{"error":"denied"}`)
+	}
+}
+
+func TestGRPCBackendDoErrorsOnNonOKHTTPStatus(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(checkMethodPath, func(w http.ResponseWriter, r *http.Request) {
+		// An intermediary (proxy/LB) in front of the sidecar answering at
+		// the HTTP level, with no grpc-status header and an empty body
+		// that carries no CheckResponse frame.
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	server := httptest.NewUnstartedServer(h2c.NewHandler(mux, &http2.Server{}))
+	server.Start()
+	t.Cleanup(server.Close)
+
+	backend, forwardReq := dial(t, "grpc://"+server.Listener.Addr().String())
+
+	if _, err := backend.Do(forwardReq); err == nil {
+		t.Fatal("Do: expected an error for a non-200 HTTP status, got nil")
+	}
+}
+
+func TestGRPCBackendEncodesForwardedAttributes(t *testing.T) {
+	var gotHeaders map[string]string
+	var gotMethod, gotPath, gotHost, gotScheme string
+
+	server := newCheckTestServer(t, func(checkRequest []byte) []byte {
+		gotHeaders = make(map[string]string)
+
+		for _, f := range pbFields(checkRequest) {
+			if f.num != 1 { // attributes
+				continue
+			}
+			for _, af := range pbFields(f.bytes) {
+				if af.num != 4 { // request
+					continue
+				}
+				for _, rf := range pbFields(af.bytes) {
+					if rf.num != 2 { // http
+						continue
+					}
+					for _, hf := range pbFields(rf.bytes) {
+						switch hf.num {
+						case 2:
+							gotMethod = string(hf.bytes)
+						case 3:
+							var key, value string
+							for _, ef := range pbFields(hf.bytes) {
+								switch ef.num {
+								case 1:
+									key = string(ef.bytes)
+								case 2:
+									value = string(ef.bytes)
+								}
+							}
+							gotHeaders[key] = value
+						case 4:
+							gotPath = string(hf.bytes)
+						case 5:
+							gotHost = string(hf.bytes)
+						case 6:
+							gotScheme = string(hf.bytes)
+						}
+					}
+				}
+			}
+		}
+
+		var resp []byte
+		return appendBytes(resp, 3, nil) // empty ok_response
+	})
+
+	backend, forwardReq := dial(t, "grpc://"+server.Listener.Addr().String())
+
+	if _, err := backend.Do(forwardReq); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	if gotMethod != http.MethodGet {
+		t.Errorf("method = %q, want %q", gotMethod, http.MethodGet)
+	}
+	if gotPath != "/admin" {
+		t.Errorf("path = %q, want %q", gotPath, "/admin")
+	}
+	if gotHost != "example.com" {
+		t.Errorf("host = %q, want %q", gotHost, "example.com")
+	}
+	if gotScheme != "http" {
+		t.Errorf("scheme = %q, want %q", gotScheme, "http")
+	}
+	if gotHeaders["authorization"] != "Bearer token" {
+		t.Errorf("authorization header = %q, want %q", gotHeaders["authorization"], "Bearer token")
+	}
+}
+
+func TestGRPCFrameRoundTrip(t *testing.T) {
+	msg := []byte("hello world")
+
+	got, err := unframeGRPCMessage(grpcFrame(msg))
+	if err != nil {
+		t.Fatalf("unframeGRPCMessage: %v", err)
+	}
+	if string(got) != string(msg) {
+		t.Errorf("got %q, want %q", got, msg)
+	}
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+	return u
+}
@@ -79,9 +79,16 @@ const (
 )
 
 // Remover removes hop-by-hop headers listed in the "Connection" header.
-// See RFC 7230, section 6.1.
+// See RFC 7230, section 6.1. Connection: Upgrade requests are left alone,
+// since the Connection/Upgrade/Sec-WebSocket-* headers they carry are what
+// next needs to recognize and hijack the handshake.
 func Remover(next http.Handler) http.HandlerFunc {
 	return func(rw http.ResponseWriter, req *http.Request) {
+		if isUpgradeRequest(req.Header) {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
 		removeConnectionHeaders(req.Header)
 		req.Header.Del(connectionHeader)
 		next.ServeHTTP(rw, req)
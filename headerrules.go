@@ -0,0 +1,143 @@
+package traefik_forward_filter
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// HeaderRule conditionally sets, appends, or deletes a header. Exactly one
+// of Set, Append, or Del must be given; When and Value are expressions in
+// the subset documented by expr.go, with access to req.headers/method/path
+// and, for ResponseHeaderRules, resp.status/headers. An empty When always
+// matches.
+type HeaderRule struct {
+	When   string `json:"when,omitempty"`
+	Set    string `json:"set,omitempty"`
+	Append string `json:"append,omitempty"`
+	Del    string `json:"del,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type headerRuleAction int
+
+const (
+	headerRuleSet headerRuleAction = iota
+	headerRuleAppend
+	headerRuleDel
+)
+
+type compiledHeaderRule struct {
+	when   expr
+	header string
+	action headerRuleAction
+	value  expr
+}
+
+func compileHeaderRules(rules []HeaderRule) ([]compiledHeaderRule, error) {
+	compiled := make([]compiledHeaderRule, 0, len(rules))
+
+	for _, rule := range rules {
+		var (
+			header string
+			action headerRuleAction
+		)
+
+		switch {
+		case rule.Set != "":
+			header, action = rule.Set, headerRuleSet
+		case rule.Append != "":
+			header, action = rule.Append, headerRuleAppend
+		case rule.Del != "":
+			header, action = rule.Del, headerRuleDel
+		default:
+			return nil, fmt.Errorf("header rule needs one of set, append, or del")
+		}
+
+		if action != headerRuleDel && rule.Value == "" {
+			return nil, fmt.Errorf("header rule for %q needs a value", header)
+		}
+
+		var when expr
+		if rule.When != "" {
+			compiledWhen, err := compileExpr(rule.When)
+			if err != nil {
+				return nil, err
+			}
+			when = compiledWhen
+		}
+
+		var value expr
+		if rule.Value != "" {
+			compiledValue, err := compileExpr(rule.Value)
+			if err != nil {
+				return nil, err
+			}
+			value = compiledValue
+		}
+
+		compiled = append(compiled, compiledHeaderRule{
+			when:   when,
+			header: http.CanonicalHeaderKey(header),
+			action: action,
+			value:  value,
+		})
+	}
+
+	return compiled, nil
+}
+
+// applyHeaderRules runs rules in order against env, mutating header. A rule whose When
+// fails to evaluate, or evaluates falsy, is skipped rather than aborting the
+// rest of the chain.
+func applyHeaderRules(rules []compiledHeaderRule, env *ruleEnv, header http.Header) {
+	for _, rule := range rules {
+		if rule.when != nil {
+			matched, err := rule.when.eval(env)
+			if err != nil || !truthy(matched) {
+				continue
+			}
+		}
+
+		if rule.action == headerRuleDel {
+			header.Del(rule.header)
+			continue
+		}
+
+		v, err := rule.value.eval(env)
+		if err != nil {
+			continue
+		}
+
+		s := valueToString(v)
+
+		if rule.action == headerRuleAppend {
+			header.Add(rule.header, s)
+		} else {
+			header.Set(rule.header, s)
+		}
+	}
+}
+
+func valueToString(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case bool:
+		if t {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return fmt.Sprintf("%g", t)
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
+
+func requestAttrs(r *http.Request) reqAttrs {
+	return reqAttrs{
+		Method:  r.Method,
+		Path:    r.URL.Path,
+		Headers: map[string][]string(r.Header),
+	}
+}
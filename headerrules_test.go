@@ -0,0 +1,105 @@
+package traefik_forward_filter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCompileHeaderRulesRejectsNoAction(t *testing.T) {
+	_, err := compileHeaderRules([]HeaderRule{{When: "req.method == \"GET\""}})
+	if err == nil {
+		t.Fatal("compileHeaderRules: want error for a rule with no set/append/del")
+	}
+}
+
+func TestCompileHeaderRulesRejectsMissingValue(t *testing.T) {
+	_, err := compileHeaderRules([]HeaderRule{{Set: "X-Foo"}})
+	if err == nil {
+		t.Fatal("compileHeaderRules: want error for set without a value")
+	}
+}
+
+func TestCompileHeaderRulesDelNeedsNoValue(t *testing.T) {
+	_, err := compileHeaderRules([]HeaderRule{{Del: "X-Foo"}})
+	if err != nil {
+		t.Fatalf("compileHeaderRules: %v", err)
+	}
+}
+
+func TestApplyHeaderRulesSet(t *testing.T) {
+	rules, err := compileHeaderRules([]HeaderRule{{Set: "X-Foo", Value: `"bar"`}})
+	if err != nil {
+		t.Fatalf("compileHeaderRules: %v", err)
+	}
+
+	header := http.Header{}
+	applyHeaderRules(rules, &ruleEnv{req: reqAttrs{}}, header)
+
+	if got := header.Get("X-Foo"); got != "bar" {
+		t.Fatalf("X-Foo = %q, want %q", got, "bar")
+	}
+}
+
+func TestApplyHeaderRulesAppend(t *testing.T) {
+	rules, err := compileHeaderRules([]HeaderRule{{Append: "X-Foo", Value: `"baz"`}})
+	if err != nil {
+		t.Fatalf("compileHeaderRules: %v", err)
+	}
+
+	header := http.Header{"X-Foo": {"bar"}}
+	applyHeaderRules(rules, &ruleEnv{req: reqAttrs{}}, header)
+
+	if got := header.Values("X-Foo"); len(got) != 2 || got[0] != "bar" || got[1] != "baz" {
+		t.Fatalf("X-Foo = %v, want [bar baz]", got)
+	}
+}
+
+func TestApplyHeaderRulesDel(t *testing.T) {
+	rules, err := compileHeaderRules([]HeaderRule{{Del: "X-Foo"}})
+	if err != nil {
+		t.Fatalf("compileHeaderRules: %v", err)
+	}
+
+	header := http.Header{"X-Foo": {"bar"}}
+	applyHeaderRules(rules, &ruleEnv{req: reqAttrs{}}, header)
+
+	if header.Get("X-Foo") != "" {
+		t.Fatalf("X-Foo = %q, want deleted", header.Get("X-Foo"))
+	}
+}
+
+func TestApplyHeaderRulesWhenFalseSkipsRule(t *testing.T) {
+	rules, err := compileHeaderRules([]HeaderRule{{
+		When:  `req.method == "POST"`,
+		Set:   "X-Foo",
+		Value: `"bar"`,
+	}})
+	if err != nil {
+		t.Fatalf("compileHeaderRules: %v", err)
+	}
+
+	header := http.Header{}
+	applyHeaderRules(rules, &ruleEnv{req: reqAttrs{Method: "GET"}}, header)
+
+	if got := header.Get("X-Foo"); got != "" {
+		t.Fatalf("X-Foo = %q, want unset (When should have skipped the rule)", got)
+	}
+}
+
+func TestApplyHeaderRulesWhenTrueRunsRule(t *testing.T) {
+	rules, err := compileHeaderRules([]HeaderRule{{
+		When:  `req.method == "POST"`,
+		Set:   "X-Foo",
+		Value: `"bar"`,
+	}})
+	if err != nil {
+		t.Fatalf("compileHeaderRules: %v", err)
+	}
+
+	header := http.Header{}
+	applyHeaderRules(rules, &ruleEnv{req: reqAttrs{Method: "POST"}}, header)
+
+	if got := header.Get("X-Foo"); got != "bar" {
+		t.Fatalf("X-Foo = %q, want %q", got, "bar")
+	}
+}
@@ -0,0 +1,99 @@
+package traefik_forward_filter
+
+import "encoding/binary"
+
+// Minimal protobuf wire-format encode/decode helpers, just enough to speak
+// the handful of envoy.service.auth.v3 messages grpc_backend.go needs. See
+// the doc comment on grpcBackend for why this avoids the usual
+// google.golang.org/protobuf generated code.
+
+func appendVarint(buf []byte, v uint64) []byte {
+	for v >= 0x80 {
+		buf = append(buf, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(buf, byte(v))
+}
+
+func appendTag(buf []byte, fieldNum int, wireType byte) []byte {
+	return appendVarint(buf, uint64(fieldNum)<<3|uint64(wireType))
+}
+
+// appendBytes appends a length-delimited (wire type 2) field: a string, a
+// nested message, and a map entry all share this encoding.
+func appendBytes(buf []byte, fieldNum int, v []byte) []byte {
+	buf = appendTag(buf, fieldNum, 2)
+	buf = appendVarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
+
+// appendString omits the field entirely when s is empty, matching proto3's
+// own "empty means unset" encoding.
+func appendString(buf []byte, fieldNum int, s string) []byte {
+	if s == "" {
+		return buf
+	}
+	return appendBytes(buf, fieldNum, []byte(s))
+}
+
+// appendMapEntry encodes one entry of a protobuf map<string,string> field,
+// which the wire format represents as a repeated nested message of
+// {1: key, 2: value}.
+func appendMapEntry(buf []byte, fieldNum int, key, value string) []byte {
+	var entry []byte
+	entry = appendString(entry, 1, key)
+	entry = appendString(entry, 2, value)
+	return appendBytes(buf, fieldNum, entry)
+}
+
+// pbField is one decoded top-level field from a protobuf message: its field
+// number and payload, either the varint value (wire type 0) or the raw
+// inner bytes (wire type 2, used for strings, bytes, and nested messages).
+type pbField struct {
+	num      int
+	wireType byte
+	varint   uint64
+	bytes    []byte
+}
+
+// pbFields decodes buf into its top-level fields. It only understands wire
+// types 0 and 2, the only ones the messages grpc_backend.go decodes use; encountering
+// any other wire type, or a truncated field, stops decoding and returns
+// whatever fields were parsed so far, same as CheckResponse simply omitting
+// that field.
+func pbFields(buf []byte) []pbField {
+	var fields []pbField
+
+	for len(buf) > 0 {
+		tag, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return fields
+		}
+		buf = buf[n:]
+
+		fieldNum := int(tag >> 3)
+		wireType := byte(tag & 0x7)
+
+		switch wireType {
+		case 0:
+			v, n := binary.Uvarint(buf)
+			if n <= 0 {
+				return fields
+			}
+			buf = buf[n:]
+			fields = append(fields, pbField{num: fieldNum, wireType: wireType, varint: v})
+		case 2:
+			length, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < length {
+				return fields
+			}
+			buf = buf[n:]
+			fields = append(fields, pbField{num: fieldNum, wireType: wireType, bytes: buf[:length]})
+			buf = buf[length:]
+		default:
+			return fields
+		}
+	}
+
+	return fields
+}
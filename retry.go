@@ -0,0 +1,108 @@
+package traefik_forward_filter
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// DefaultBackoffInitial and DefaultBackoffMax bound the retry backoff when
+// BackoffInitialMs/BackoffMaxMs are left unset.
+const (
+	DefaultBackoffInitial = 50 * time.Millisecond
+	DefaultBackoffMax     = 2 * time.Second
+)
+
+// errBreakerOpen is returned by doWithRetry in place of ever dialing Address
+// while the circuit breaker is open.
+var errBreakerOpen = errors.New("forward auth circuit breaker is open")
+
+// doWithRetry calls f.backend.Do, retrying up to f.MaxRetries times on
+// network errors and the statuses listed in f.RetryOnStatusCode, with
+// full-jitter backoff between attempts. rebuildBody, when non-nil, is
+// called to get a fresh request body before each retry. The circuit
+// breaker, if configured, fails fast without calling Do while open.
+func (f *ForwardFilter) doWithRetry(forwardReq *http.Request, rebuildBody func() (io.ReadCloser, error)) (*http.Response, error) {
+	var lastErr error
+	var lastResp *http.Response
+
+	for attempt := 0; attempt <= f.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if rebuildBody != nil {
+				body, err := rebuildBody()
+				if err != nil {
+					return nil, err
+				}
+				forwardReq.Body = body
+			}
+
+			time.Sleep(backoffDelay(attempt-1, time.Duration(f.BackoffInitialMs)*time.Millisecond, time.Duration(f.BackoffMaxMs)*time.Millisecond))
+		}
+
+		if f.breaker != nil && !f.breaker.allow() {
+			// backend.Do is never reached on this attempt, so nothing will
+			// consume or close forwardReq.Body the way a real Do call
+			// would: close it ourselves to avoid leaking a disk-spooled
+			// body's open file descriptor.
+			if forwardReq.Body != nil {
+				forwardReq.Body.Close()
+			}
+			return nil, errBreakerOpen
+		}
+
+		resp, err := f.backend.Do(forwardReq)
+		retryable := err != nil || isRetryableStatus(statusCodeOf(resp), f.RetryOnStatusCode)
+
+		if f.breaker != nil {
+			f.breaker.record(!retryable)
+		}
+
+		lastErr, lastResp = err, resp
+
+		if !retryable || attempt == f.MaxRetries {
+			return resp, err
+		}
+
+		if resp != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+	}
+
+	return lastResp, lastErr
+}
+
+func isRetryableStatus(statusCode int, retryOn []int) bool {
+	for _, s := range retryOn {
+		if s == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func statusCodeOf(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+// backoffDelay returns a full-jitter delay for the given 0-indexed retry
+// attempt. See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/.
+func backoffDelay(attempt int, initial, max time.Duration) time.Duration {
+	if initial <= 0 {
+		initial = DefaultBackoffInitial
+	}
+	if max <= 0 {
+		max = DefaultBackoffMax
+	}
+
+	backoff := initial << attempt
+	if backoff <= 0 || backoff > max {
+		backoff = max
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
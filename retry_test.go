@@ -0,0 +1,191 @@
+package traefik_forward_filter
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type fakeBackend struct {
+	calls     int
+	responses []*http.Response
+	errs      []error
+}
+
+func (b *fakeBackend) Do(*http.Request) (*http.Response, error) {
+	i := b.calls
+	b.calls++
+
+	var resp *http.Response
+	if i < len(b.responses) {
+		resp = b.responses[i]
+	}
+
+	var err error
+	if i < len(b.errs) {
+		err = b.errs[i]
+	}
+
+	return resp, err
+}
+
+func newTestResponse(statusCode int) *http.Response {
+	return &http.Response{StatusCode: statusCode, Body: io.NopCloser(bytes.NewReader(nil))}
+}
+
+func TestDoWithRetryRetriesOnNetworkError(t *testing.T) {
+	backend := &fakeBackend{
+		errs:      []error{errors.New("dial failed"), nil},
+		responses: []*http.Response{nil, newTestResponse(http.StatusOK)},
+	}
+
+	f := &ForwardFilter{Config: Config{MaxRetries: 1}, backend: backend}
+
+	resp, err := f.doWithRetry(newRetryTestRequest(), nil)
+	if err != nil {
+		t.Fatalf("doWithRetry: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if backend.calls != 2 {
+		t.Errorf("backend called %d times, want 2", backend.calls)
+	}
+}
+
+func TestDoWithRetryRetriesOnRetryableStatus(t *testing.T) {
+	backend := &fakeBackend{
+		responses: []*http.Response{newTestResponse(http.StatusBadGateway), newTestResponse(http.StatusOK)},
+	}
+
+	f := &ForwardFilter{Config: Config{MaxRetries: 1, RetryOnStatusCode: []int{http.StatusBadGateway}}, backend: backend}
+
+	resp, err := f.doWithRetry(newRetryTestRequest(), nil)
+	if err != nil {
+		t.Fatalf("doWithRetry: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if backend.calls != 2 {
+		t.Errorf("backend called %d times, want 2", backend.calls)
+	}
+}
+
+func TestDoWithRetryGivesUpAfterMaxRetries(t *testing.T) {
+	backend := &fakeBackend{
+		responses: []*http.Response{
+			newTestResponse(http.StatusBadGateway),
+			newTestResponse(http.StatusBadGateway),
+		},
+	}
+
+	f := &ForwardFilter{Config: Config{MaxRetries: 1, RetryOnStatusCode: []int{http.StatusBadGateway}}, backend: backend}
+
+	resp, err := f.doWithRetry(newRetryTestRequest(), nil)
+	if err != nil {
+		t.Fatalf("doWithRetry: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusBadGateway)
+	}
+	if backend.calls != 2 {
+		t.Errorf("backend called %d times, want 2 (initial attempt + MaxRetries)", backend.calls)
+	}
+}
+
+func TestDoWithRetryRebuildsBodyBeforeRetry(t *testing.T) {
+	backend := &fakeBackend{
+		responses: []*http.Response{newTestResponse(http.StatusBadGateway), newTestResponse(http.StatusOK)},
+	}
+
+	var rebuildCalls int
+	rebuild := func() (io.ReadCloser, error) {
+		rebuildCalls++
+		return io.NopCloser(bytes.NewReader([]byte("body"))), nil
+	}
+
+	f := &ForwardFilter{Config: Config{MaxRetries: 1, RetryOnStatusCode: []int{http.StatusBadGateway}}, backend: backend}
+
+	req := newRetryTestRequest()
+	if _, err := f.doWithRetry(req, rebuild); err != nil {
+		t.Fatalf("doWithRetry: %v", err)
+	}
+
+	if rebuildCalls != 1 {
+		t.Errorf("rebuild called %d times, want 1", rebuildCalls)
+	}
+}
+
+func TestDoWithRetryFailsFastWhenBreakerOpen(t *testing.T) {
+	backend := &fakeBackend{responses: []*http.Response{newTestResponse(http.StatusOK)}}
+
+	breaker := newCircuitBreaker(&Config{ConsecutiveFailures: 1, OpenDurationMs: 60_000})
+	breaker.record(false)
+
+	f := &ForwardFilter{backend: backend, breaker: breaker}
+
+	_, err := f.doWithRetry(newRetryTestRequest(), nil)
+	if !errors.Is(err, errBreakerOpen) {
+		t.Fatalf("err = %v, want errBreakerOpen", err)
+	}
+	if backend.calls != 0 {
+		t.Errorf("backend called %d times, want 0 while breaker is open", backend.calls)
+	}
+}
+
+type closeTrackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeTrackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestDoWithRetryClosesBodyWhenBreakerOpenBeforeFirstAttempt(t *testing.T) {
+	backend := &fakeBackend{responses: []*http.Response{newTestResponse(http.StatusOK)}}
+
+	breaker := newCircuitBreaker(&Config{ConsecutiveFailures: 1, OpenDurationMs: 60_000})
+	breaker.record(false)
+
+	f := &ForwardFilter{backend: backend, breaker: breaker}
+
+	req := newRetryTestRequest()
+	body := &closeTrackingBody{Reader: bytes.NewReader(nil)}
+	req.Body = body
+
+	if _, err := f.doWithRetry(req, nil); !errors.Is(err, errBreakerOpen) {
+		t.Fatalf("err = %v, want errBreakerOpen", err)
+	}
+	if !body.closed {
+		t.Error("forwardReq.Body was not closed when the breaker failed fast, would leak it")
+	}
+}
+
+func TestBackoffDelayIsBoundedByMax(t *testing.T) {
+	max := 10 * time.Millisecond
+
+	for attempt := 0; attempt < 10; attempt++ {
+		delay := backoffDelay(attempt, time.Millisecond, max)
+		if delay > max {
+			t.Fatalf("attempt %d: delay %v exceeds max %v", attempt, delay, max)
+		}
+	}
+}
+
+func TestBackoffDelayUsesDefaultsWhenUnset(t *testing.T) {
+	delay := backoffDelay(0, 0, 0)
+	if delay > DefaultBackoffInitial {
+		t.Fatalf("delay %v exceeds default initial %v", delay, DefaultBackoffInitial)
+	}
+}
+
+func newRetryTestRequest() *http.Request {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	return req
+}
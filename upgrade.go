@@ -0,0 +1,37 @@
+package traefik_forward_filter
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	// UpgradeBypass skips the forward-auth call entirely for Connection:
+	// Upgrade requests (e.g. WebSocket handshakes), passing them straight to
+	// next.
+	UpgradeBypass = "bypass"
+	// UpgradeAuthOnce calls Address once, synchronously, with the handshake
+	// headers, then passes the request to next with its handshake headers
+	// intact (plus any ResponseHeaders and ResponseHeaderRules output) so it
+	// can hijack the connection and proxy the upgraded stream without any
+	// further calls back into this middleware.
+	UpgradeAuthOnce = "auth-once"
+)
+
+// isUpgradeRequest reports whether header carries a Connection: Upgrade
+// request, per RFC 7230 section 6.7.
+func isUpgradeRequest(header http.Header) bool {
+	if header.Get(Upgrade) == "" {
+		return false
+	}
+
+	for _, f := range header[Connection] {
+		for _, sf := range strings.Split(f, ",") {
+			if strings.EqualFold(strings.TrimSpace(sf), Upgrade) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
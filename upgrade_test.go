@@ -0,0 +1,48 @@
+package traefik_forward_filter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIsUpgradeRequest(t *testing.T) {
+	cases := []struct {
+		name   string
+		header http.Header
+		want   bool
+	}{
+		{
+			name:   "websocket handshake",
+			header: http.Header{Connection: {"Upgrade"}, Upgrade: {"websocket"}},
+			want:   true,
+		},
+		{
+			name:   "connection lists upgrade among other tokens",
+			header: http.Header{Connection: {"keep-alive, Upgrade"}, Upgrade: {"websocket"}},
+			want:   true,
+		},
+		{
+			name:   "no upgrade header",
+			header: http.Header{Connection: {"Upgrade"}},
+			want:   false,
+		},
+		{
+			name:   "no connection header",
+			header: http.Header{Upgrade: {"websocket"}},
+			want:   false,
+		},
+		{
+			name:   "connection header missing the upgrade token",
+			header: http.Header{Connection: {"keep-alive"}, Upgrade: {"websocket"}},
+			want:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isUpgradeRequest(tc.header); got != tc.want {
+				t.Errorf("isUpgradeRequest() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}